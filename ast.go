@@ -0,0 +1,69 @@
+package visualizephp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/VKCOM/php-parser/pkg/ast"
+)
+
+var vertexType = reflect.TypeOf((*ast.Vertex)(nil)).Elem()
+
+// WriteAST writes the syntax tree of a file as an indented outline, a
+// node per line with the field holding it, its type, its lines and, for
+// names and scalars, its value. Nodes deeper than depth are left out; a
+// depth of 0 writes the whole tree.
+func WriteAST(w io.Writer, root *ast.Root, depth int) error {
+	out := bufio.NewWriter(w)
+	writeASTNode(out, "", root, 0, depth)
+	return out.Flush()
+}
+
+func writeASTNode(out *bufio.Writer, field string, n ast.Vertex, level, depth int) {
+	v := reflect.ValueOf(n)
+	if v.IsNil() {
+		return
+	}
+	v = v.Elem()
+
+	out.WriteString(strings.Repeat("  ", level))
+	if field != "" {
+		out.WriteString(field + ": ")
+	}
+	out.WriteString(v.Type().Name())
+	if pos := n.GetPosition(); pos != nil {
+		if pos.StartLine == pos.EndLine {
+			fmt.Fprintf(out, " %d", pos.StartLine)
+		} else {
+			fmt.Fprintf(out, " %d-%d", pos.StartLine, pos.EndLine)
+		}
+	}
+	if value := v.FieldByName("Value"); value.IsValid() && value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+		out.WriteString(" " + strconv.Quote(string(value.Bytes())))
+	}
+	out.WriteString("\n")
+
+	if depth > 0 && level >= depth {
+		return
+	}
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		f := v.Field(i)
+		switch {
+		case f.Type() == vertexType:
+			if !f.IsNil() {
+				writeASTNode(out, name, f.Interface().(ast.Vertex), level+1, depth)
+			}
+		case f.Kind() == reflect.Slice && f.Type().Elem() == vertexType:
+			for j := 0; j < f.Len(); j++ {
+				if c := f.Index(j); !c.IsNil() {
+					writeASTNode(out, name, c.Interface().(ast.Vertex), level+1, depth)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package visualizephp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/VKCOM/php-parser/pkg/ast"
+)
+
+// Autoloader finds the files Composer autoloads classes from, following
+// the psr-4, psr-0 and classmap rules of composer.json and, when the
+// packages are installed, of vendor/composer/autoload_*.php.
+type Autoloader struct {
+	// VendorDir is the directory Composer installs packages in.
+	VendorDir string
+	// Files are the files Composer includes on every request.
+	Files []string
+
+	psr4 []autoloadPrefix
+	psr0 []autoloadPrefix
+	// classmap maps lower case class names to files.
+	classmap map[string]string
+}
+
+// autoloadPrefix is a namespace prefix and the directories its classes
+// are in.
+type autoloadPrefix struct {
+	prefix string
+	dirs   []string
+}
+
+// composerPaths is a path or list of paths in composer.json.
+type composerPaths []string
+
+func (p *composerPaths) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*p = composerPaths{path}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(p))
+}
+
+// composerAutoload is an autoload or autoload-dev section.
+type composerAutoload struct {
+	PSR4     map[string]composerPaths `json:"psr-4"`
+	PSR0     map[string]composerPaths `json:"psr-0"`
+	Classmap []string
+	Files    []string
+}
+
+// LoadAutoloader reads the autoload rules of the composer.json at path,
+// autoload-dev included. The classes of classmap directories are found by
+// parsing their files, with phpVersion given to PHPVersion, when Composer
+// did not write the class map to the vendor directory.
+func LoadAutoloader(path, phpVersion string) (*Autoloader, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var composer struct {
+		Autoload    composerAutoload
+		AutoloadDev composerAutoload `json:"autoload-dev"`
+		Config      struct {
+			VendorDir string `json:"vendor-dir"`
+		}
+	}
+	if err := json.Unmarshal(data, &composer); err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(path)
+	a := &Autoloader{VendorDir: filepath.Join(dir, "vendor"), classmap: make(map[string]string)}
+	if composer.Config.VendorDir != "" {
+		a.VendorDir = filepath.Join(dir, composer.Config.VendorDir)
+	}
+
+	generated := filepath.Join(a.VendorDir, "composer")
+	if _, err := os.Stat(filepath.Join(generated, "autoload_psr4.php")); err == nil {
+		// the installed rules cover the project and its packages
+		if err := a.readGenerated(generated); err != nil {
+			return nil, err
+		}
+	} else {
+		var classmap []string
+		for _, section := range []composerAutoload{composer.Autoload, composer.AutoloadDev} {
+			a.psr4 = append(a.psr4, autoloadPrefixes(dir, section.PSR4)...)
+			a.psr0 = append(a.psr0, autoloadPrefixes(dir, section.PSR0)...)
+			for _, p := range section.Classmap {
+				classmap = append(classmap, filepath.Join(dir, p))
+			}
+			for _, p := range section.Files {
+				a.Files = append(a.Files, filepath.Join(dir, p))
+			}
+		}
+		a.scanClassmap(classmap, phpVersion)
+	}
+
+	// the longest prefix wins
+	for _, prefixes := range [][]autoloadPrefix{a.psr4, a.psr0} {
+		sort.Slice(prefixes, func(i, j int) bool {
+			if len(prefixes[i].prefix) != len(prefixes[j].prefix) {
+				return len(prefixes[i].prefix) > len(prefixes[j].prefix)
+			}
+			return prefixes[i].prefix < prefixes[j].prefix
+		})
+	}
+	return a, nil
+}
+
+func autoloadPrefixes(dir string, rules map[string]composerPaths) []autoloadPrefix {
+	var prefixes []autoloadPrefix
+	for prefix, paths := range rules {
+		p := autoloadPrefix{prefix: strings.TrimPrefix(prefix, `\`)}
+		for _, path := range paths {
+			p.dirs = append(p.dirs, filepath.Join(dir, path))
+		}
+		prefixes = append(prefixes, p)
+	}
+	return prefixes
+}
+
+// scanClassmap maps the classes declared in the PHP files under paths to
+// their files, as Composer does when dumping the autoloader.
+func (a *Autoloader) scanClassmap(paths []string, phpVersion string) {
+	b := newIncludeBuilder(phpVersion)
+	for _, path := range paths {
+		filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || !phpExtensions[filepath.Ext(p)] {
+				return nil
+			}
+			f := b.file(p)
+			if f.Root == nil {
+				return nil
+			}
+			d := newFileDecls(f)
+			for _, c := range d.classes {
+				if c, ok := c.(*ast.StmtClass); ok && c.Name == nil {
+					continue
+				}
+				if key := strings.ToLower(d.className(c)); a.classmap[key] == "" {
+					a.classmap[key] = p
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// readGenerated reads the rules Composer wrote to dir when installing.
+func (a *Autoloader) readGenerated(dir string) error {
+	read := func(name string) (map[string][]string, error) {
+		return readAutoloadArray(filepath.Join(dir, name))
+	}
+	for name, prefixes := range map[string]*[]autoloadPrefix{
+		"autoload_psr4.php":       &a.psr4,
+		"autoload_namespaces.php": &a.psr0,
+	} {
+		rules, err := read(name)
+		if err != nil {
+			return err
+		}
+		for prefix, dirs := range rules {
+			*prefixes = append(*prefixes, autoloadPrefix{prefix: prefix, dirs: dirs})
+		}
+	}
+	classmap, err := read("autoload_classmap.php")
+	if err != nil {
+		return err
+	}
+	for class, files := range classmap {
+		a.classmap[strings.ToLower(class)] = files[0]
+	}
+	files, err := read("autoload_files.php")
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		a.Files = append(a.Files, f...)
+	}
+	sort.Strings(a.Files)
+	return nil
+}
+
+// readAutoloadArray reads the array a vendor/composer/autoload_*.php file
+// returns, mapping each key to its path or paths. A file that does not
+// exist is an empty array, Composer does not write all of them.
+func readAutoloadArray(path string) (map[string][]string, error) {
+	src, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	root, err := ParseFile(src, DefaultPHPVersion)
+	if root == nil {
+		return nil, err
+	}
+
+	// $vendorDir = dirname(__DIR__); $baseDir = dirname($vendorDir);
+	vars := make(map[string]string)
+	rules := make(map[string][]string)
+	for _, stmt := range root.Stmts {
+		switch n := stmt.(type) {
+		case *ast.StmtExpression:
+			assign, ok := n.Expr.(*ast.ExprAssign)
+			if !ok {
+				continue
+			}
+			if v, ok := staticString(assign.Expr, path, vars); ok {
+				vars[variableName(assign.Var)] = v
+			}
+		case *ast.StmtReturn:
+			array, ok := n.Expr.(*ast.ExprArray)
+			if !ok {
+				continue
+			}
+			for _, item := range array.Items {
+				item, ok := item.(*ast.ExprArrayItem)
+				if !ok || item.Key == nil {
+					continue
+				}
+				key, ok := staticString(item.Key, path, vars)
+				if !ok {
+					continue
+				}
+				values := []ast.Vertex{item.Val}
+				if list, ok := item.Val.(*ast.ExprArray); ok {
+					values = nil
+					for _, item := range list.Items {
+						if item, ok := item.(*ast.ExprArrayItem); ok {
+							values = append(values, item.Val)
+						}
+					}
+				}
+				for _, v := range values {
+					if v, ok := staticString(v, path, vars); ok {
+						rules[key] = append(rules[key], filepath.Clean(v))
+					}
+				}
+			}
+		}
+	}
+	return rules, nil
+}
+
+// Lookup returns the file class, with its namespace, is autoloaded from,
+// "" when no rule gives an existing file.
+func (a *Autoloader) Lookup(class string) string {
+	class = strings.TrimPrefix(class, `\`)
+	if path := a.classmap[strings.ToLower(class)]; path != "" {
+		return path
+	}
+	for _, p := range a.psr4 {
+		if !strings.HasPrefix(class, p.prefix) {
+			continue
+		}
+		rel := strings.ReplaceAll(class[len(p.prefix):], `\`, "/") + ".php"
+		if path := existing(p.dirs, rel); path != "" {
+			return path
+		}
+	}
+	for _, p := range a.psr0 {
+		if !strings.HasPrefix(class, p.prefix) {
+			continue
+		}
+		// underscores in the class name, not the namespace, are
+		// directories too
+		i := strings.LastIndex(class, `\`) + 1
+		rel := strings.ReplaceAll(class[:i], `\`, "/") + strings.ReplaceAll(class[i:], "_", "/") + ".php"
+		if path := existing(p.dirs, rel); path != "" {
+			return path
+		}
+	}
+	return ""
+}
+
+// existing returns the first of the dirs holding the file rel, joined to
+// it.
+func existing(dirs []string, rel string) string {
+	for _, dir := range dirs {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
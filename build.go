@@ -0,0 +1,81 @@
+package visualizephp
+
+import (
+	"io/ioutil"
+)
+
+// Options are the settings of BuildFlow.
+type Options struct {
+	// PHPVersion is the version the source is written for, such as
+	// "8.1". When empty it is picked as PHPVersion does.
+	PHPVersion string
+	// InlineIncludes draws the files included by include and require
+	// where they are included, see AstReader.InlineIncludes.
+	InlineIncludes bool
+	// ExpandCalls is how many calls deep to draw the functions of the
+	// file where they are called, see AstReader.ExpandCalls. 0 leaves
+	// calls alone.
+	ExpandCalls int
+	// Labels cuts and wraps the labels of the flow.
+	Labels LabelFormat
+}
+
+// BuildFlow parses file and returns the flowchart of its top level and
+// of each of its functions. src is the content of file, read from it when
+// nil. As with ParseFile, syntax errors the parser recovered from are
+// returned as ParseErrors along with the flow, where they are drawn as
+// unparseable nodes.
+func BuildFlow(file string, src []byte, opts Options) (*Flow, error) {
+	if src == nil {
+		var err error
+		if src, err = ioutil.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	version, err := PHPVersion(file, src, opts.PHPVersion)
+	if err != nil {
+		return nil, err
+	}
+	root, err := ParseFile(src, version)
+	if root == nil {
+		return nil, err
+	}
+	errs, _ := err.(ParseErrors)
+
+	a := NewAstReader(src, errs)
+	a.SetFile(file)
+	if opts.InlineIncludes {
+		if err := a.InlineIncludes(file, opts.PHPVersion); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ExpandCalls > 0 {
+		a.ExpandCalls(opts.ExpandCalls)
+	}
+	a.FormatLabels(opts.Labels)
+	root.Accept(a)
+
+	flow := a.Flow()
+	flow.source = &flowSource{file: file, src: src}
+	if errs != nil {
+		return flow, errs
+	}
+	return flow, nil
+}
+
+// flowSource is the file a flow was built from, for the renderers
+// showing the source along with the graphs, as HTML does.
+type flowSource struct {
+	file string
+	src  []byte
+}
+
+// Only returns a flow holding the graph with the given name alone, as
+// Graph finds it, or nil if there is none.
+func (f *Flow) Only(name string) *Flow {
+	g := f.Graph(name)
+	if g == nil {
+		return nil
+	}
+	return &Flow{Graphs: []*Graph{g}, source: f.source}
+}
@@ -0,0 +1,736 @@
+package visualizephp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/VKCOM/php-parser/pkg/ast"
+	"github.com/VKCOM/php-parser/pkg/position"
+	"github.com/VKCOM/php-parser/pkg/visitor"
+	"github.com/VKCOM/php-parser/pkg/visitor/traverser"
+)
+
+// FunctionKind tells what calls are made from.
+type FunctionKind int
+
+const (
+	// FuncScript is the top level of a file.
+	FuncScript FunctionKind = iota
+	FuncFunction
+	FuncMethod
+)
+
+func (k FunctionKind) String() string {
+	switch k {
+	case FuncFunction:
+		return "function"
+	case FuncMethod:
+		return "method"
+	}
+	return "script"
+}
+
+// Function is a function, a method or the top level of a file in a call
+// graph.
+type Function struct {
+	// Name is the name with its namespace, without leading backslash,
+	// Class::method for methods and the file name for scripts.
+	Name string
+	Kind FunctionKind
+	File *SourceFile
+	Pos  *position.Position
+
+	// abstract is set for the methods declared without a body.
+	abstract bool
+}
+
+// Call is a call site.
+type Call struct {
+	Caller *Function
+	// Callee is nil when no function of the project has the name, or
+	// the name is only known at run time.
+	Callee *Function
+	// Name is the name as written in the call, ->method for a method
+	// called on anything but $this.
+	Name string
+	Pos  *position.Position
+	// Ambiguous is set when the class of the receiver is not known and
+	// Callee is one of the methods with the name. The call is then in
+	// Calls once per such method.
+	Ambiguous bool
+}
+
+// CallGraph holds the functions of a project and the calls between them.
+type CallGraph struct {
+	Functions []*Function
+	Calls     []*Call
+	// Unresolved are the calls to functions the project does not declare,
+	// such as the built-in ones.
+	Unresolved []*Call
+
+	// byName indexes Functions by lower case name, PHP function names
+	// are case-insensitive.
+	byName map[string]*Function
+	// classes indexes the classes, interfaces, traits and enums by lower
+	// case name.
+	classes map[string]*classInfo
+}
+
+// classInfo is what method lookup needs to know of a class.
+type classInfo struct {
+	// parent and traits are lower case names.
+	parent  string
+	traits  []string
+	methods map[string]*Function
+}
+
+// BuildCallGraph indexes the functions declared in the project and
+// resolves the calls made from them and from the top level of each file.
+// Methods are looked up through parent classes and used traits; a method
+// called on a receiver of unknown class is taken to be any method with
+// the name. Calls through variables and to functions the project does
+// not declare are unresolved. The functions of the vendor directory are
+// left out when p.ExcludeVendor is set.
+func BuildCallGraph(p *Project) *CallGraph {
+	g := &CallGraph{byName: make(map[string]*Function), classes: make(map[string]*classInfo)}
+	var files []*fileDecls
+	for _, f := range p.Files {
+		if f.Root == nil {
+			continue
+		}
+		d := newFileDecls(f)
+		files = append(files, d)
+
+		g.add(&Function{Name: p.relName(f), Kind: FuncScript, File: f, Pos: f.Root.Position})
+		for _, fn := range d.functions {
+			g.add(&Function{Name: d.qualify(nameString(fn.Name), fn.Position), Kind: FuncFunction, File: f, Pos: fn.Position})
+		}
+		for _, c := range d.classes {
+			g.addClass(d, c)
+		}
+		for _, m := range d.methods {
+			name := d.methodName(m)
+			_, abstract := m.Stmt.(*ast.StmtNop)
+			g.add(&Function{Name: name, Kind: FuncMethod, File: f, Pos: m.Position, abstract: abstract})
+			if c := g.classes[strings.ToLower(d.className(d.classAt(m.Position)))]; c != nil {
+				c.methods[strings.ToLower(nameString(m.Name))] = g.Function(name)
+			}
+		}
+	}
+
+	for _, d := range files {
+		for _, c := range d.calls {
+			name := nameString(c.Function)
+			if name == "" {
+				// $f(), known at run time only
+				name = printPHP(d.file.Src, c.Function)
+			}
+			call := &Call{
+				Caller: g.caller(d, c.Position),
+				Callee: g.resolveFunction(d, name, c.Position),
+				Name:   name,
+				Pos:    c.Position,
+			}
+			g.addCall(call)
+		}
+		for _, c := range d.methodCalls {
+			name, callees, ambiguous := g.resolveMethod(d, c)
+			call := &Call{Caller: g.caller(d, c.GetPosition()), Name: name, Pos: c.GetPosition()}
+			if len(callees) == 0 {
+				g.addCall(call)
+			}
+			for _, callee := range callees {
+				c := *call
+				c.Callee, c.Ambiguous = callee, ambiguous
+				g.addCall(&c)
+			}
+		}
+	}
+	if p.ExcludeVendor {
+		g = g.subgraph(func(f *Function) bool { return p.drawn(f.File) }, func(*Call) bool { return true })
+	}
+	return g
+}
+
+func (g *CallGraph) addCall(c *Call) {
+	if c.Callee == nil {
+		g.Unresolved = append(g.Unresolved, c)
+	} else {
+		g.Calls = append(g.Calls, c)
+	}
+}
+
+// addClass indexes the class declaration c of the file of d, its methods
+// are added as they are found.
+func (g *CallGraph) addClass(d *fileDecls, c ast.Vertex) {
+	key := strings.ToLower(d.className(c))
+	if _, ok := g.classes[key]; ok {
+		return
+	}
+	info := &classInfo{methods: make(map[string]*Function)}
+	if c, ok := c.(*ast.StmtClass); ok && c.Extends != nil {
+		info.parent = strings.ToLower(d.classRef(nameString(c.Extends), c.Position))
+	}
+	for _, u := range d.traitUses {
+		if d.classAt(u.Position) != c {
+			continue
+		}
+		for _, t := range u.Traits {
+			info.traits = append(info.traits, strings.ToLower(d.classRef(nameString(t), u.Position)))
+		}
+	}
+	g.classes[key] = info
+}
+
+func (g *CallGraph) add(f *Function) {
+	key := strings.ToLower(f.Name)
+	if _, ok := g.byName[key]; ok {
+		// declared twice, conditionally or by mistake, the first wins
+		return
+	}
+	g.byName[key] = f
+	g.Functions = append(g.Functions, f)
+}
+
+// Function returns the function, method (Class::method) or script named
+// name, nil if there is none.
+func (g *CallGraph) Function(name string) *Function {
+	return g.byName[strings.ToLower(strings.TrimPrefix(name, `\`))]
+}
+
+// caller returns the function whose body holds pos in the file of d, the
+// innermost one when they are nested, or the script.
+func (g *CallGraph) caller(d *fileDecls, pos *position.Position) *Function {
+	var inner *Function
+	var span int
+	consider := func(name string, at *position.Position) {
+		if contains(at, pos) && (inner == nil || at.EndPos-at.StartPos < span) {
+			if f := g.Function(name); f != nil && f.Pos == at {
+				inner, span = f, at.EndPos-at.StartPos
+			}
+		}
+	}
+	for _, fn := range d.functions {
+		consider(d.qualify(nameString(fn.Name), fn.Position), fn.Position)
+	}
+	for _, m := range d.methods {
+		consider(d.methodName(m), m.Position)
+	}
+	if inner == nil {
+		for _, f := range g.Functions {
+			if f.Kind == FuncScript && f.File == d.file {
+				return f
+			}
+		}
+	}
+	return inner
+}
+
+// resolveFunction finds the function a call to name made at pos in the
+// file of d refers to. An unqualified name that is neither imported nor
+// declared in the namespace falls back to the global function, as PHP
+// does.
+func (g *CallGraph) resolveFunction(d *fileDecls, name string, pos *position.Position) *Function {
+	fq, global := d.resolve(nameFunction, name, pos)
+	if f := g.Function(fq); f != nil || global == "" {
+		return f
+	}
+	return g.Function(global)
+}
+
+// resolveMethod returns the name of the method call n in the file of d as
+// written and the methods it may call, more than one when it is
+// ambiguous. Methods called through variables are not resolved.
+func (g *CallGraph) resolveMethod(d *fileDecls, n ast.Vertex) (string, []*Function, bool) {
+	var receiver, method ast.Vertex
+	switch n := n.(type) {
+	case *ast.ExprMethodCall:
+		receiver, method = n.Var, n.Method
+	case *ast.ExprNullsafeMethodCall:
+		receiver, method = n.Var, n.Method
+	case *ast.ExprStaticCall:
+		return g.resolveStaticCall(d, n)
+	}
+	name := nameString(method)
+	if name == "" {
+		return "->" + printPHP(d.file.Src, method), nil, false
+	}
+	if v, ok := receiver.(*ast.ExprVariable); ok && nameString(v.Name) == "$this" {
+		if class := d.classAt(n.GetPosition()); class != nil {
+			if f := g.method(d.className(class), name); f != nil {
+				return "$this->" + name, []*Function{f}, false
+			}
+		}
+		return "$this->" + name, g.methodsNamed(name), true
+	}
+	return "->" + name, g.methodsNamed(name), true
+}
+
+// resolveStaticCall resolves Class::method(), self::, static:: and
+// parent:: calls. static:: is taken to be self::, the class the call is
+// written in.
+func (g *CallGraph) resolveStaticCall(d *fileDecls, n *ast.ExprStaticCall) (string, []*Function, bool) {
+	ref := nameString(n.Class)
+	name := nameString(n.Call)
+	if name == "" {
+		return printPHP(d.file.Src, n.Class) + "::" + printPHP(d.file.Src, n.Call), nil, false
+	}
+	if ref == "" {
+		// $class::method()
+		return "::" + name, g.methodsNamed(name), true
+	}
+	class := ""
+	switch strings.ToLower(ref) {
+	case "self", "static":
+		if c := d.classAt(n.Position); c != nil {
+			class = d.className(c)
+		}
+	case "parent":
+		if c := d.classAt(n.Position); c != nil {
+			if info := g.classes[strings.ToLower(d.className(c))]; info != nil {
+				class = info.parent
+			}
+		}
+	default:
+		class = d.classRef(ref, n.Position)
+	}
+	if f := g.method(class, name); f != nil {
+		return ref + "::" + name, []*Function{f}, false
+	}
+	return ref + "::" + name, nil, false
+}
+
+// method looks up the method name of class, then of the traits it uses
+// and then of its parent.
+func (g *CallGraph) method(class, name string) *Function {
+	seen := make(map[string]bool)
+	var lookup func(class string) *Function
+	lookup = func(class string) *Function {
+		class = strings.ToLower(class)
+		c := g.classes[class]
+		if c == nil || seen[class] {
+			return nil
+		}
+		seen[class] = true
+		if f := c.methods[strings.ToLower(name)]; f != nil {
+			return f
+		}
+		for _, t := range c.traits {
+			if f := lookup(t); f != nil {
+				return f
+			}
+		}
+		return lookup(c.parent)
+	}
+	return lookup(class)
+}
+
+// methodsNamed returns the methods of every class with the name. The
+// abstract and interface methods, which have no body to run, are only
+// returned when no class implements the method.
+func (g *CallGraph) methodsNamed(name string) []*Function {
+	suffix := "::" + strings.ToLower(name)
+	var methods, abstract []*Function
+	for _, f := range g.Functions {
+		switch {
+		case f.Kind != FuncMethod || !strings.HasSuffix(strings.ToLower(f.Name), suffix):
+		case f.abstract:
+			abstract = append(abstract, f)
+		default:
+			methods = append(methods, f)
+		}
+	}
+	if len(methods) == 0 {
+		return abstract
+	}
+	return methods
+}
+
+// From returns the part of the graph reached from f following calls at
+// most depth deep, with no limit when depth is 0.
+func (g *CallGraph) From(f *Function, depth int) *CallGraph {
+	return g.reach(f, depth, func(c *Call) (*Function, *Function) { return c.Caller, c.Callee })
+}
+
+// To returns the part of the graph reaching f, from callers at most depth
+// calls away, with no limit when depth is 0.
+func (g *CallGraph) To(f *Function, depth int) *CallGraph {
+	return g.reach(f, depth, func(c *Call) (*Function, *Function) { return c.Callee, c.Caller })
+}
+
+// reach walks the calls breadth first from f, dir giving the end of a
+// call it starts from and the end it leads to.
+func (g *CallGraph) reach(f *Function, depth int, dir func(*Call) (*Function, *Function)) *CallGraph {
+	level := map[*Function]int{f: 0}
+	queue := []*Function{f}
+	kept := make(map[*Call]bool)
+	for len(queue) != 0 {
+		from := queue[0]
+		queue = queue[1:]
+		if depth > 0 && level[from] >= depth {
+			continue
+		}
+		for _, c := range g.Calls {
+			start, end := dir(c)
+			if start != from {
+				continue
+			}
+			kept[c] = true
+			if _, ok := level[end]; !ok {
+				level[end] = level[from] + 1
+				queue = append(queue, end)
+			}
+		}
+	}
+
+	return g.subgraph(func(f *Function) bool {
+		_, ok := level[f]
+		return ok
+	}, func(c *Call) bool { return kept[c] })
+}
+
+// subgraph returns the functions and calls of g that are kept, the calls
+// made from a function kept to one left out becoming unresolved.
+func (g *CallGraph) subgraph(keep func(*Function) bool, keepCall func(*Call) bool) *CallGraph {
+	sub := &CallGraph{byName: make(map[string]*Function), classes: g.classes}
+	for _, f := range g.Functions {
+		if keep(f) {
+			sub.add(f)
+		}
+	}
+	for _, c := range g.Calls {
+		switch {
+		case !keepCall(c) || !keep(c.Caller):
+		case keep(c.Callee):
+			sub.Calls = append(sub.Calls, c)
+		case !c.Ambiguous:
+			unresolved := *c
+			unresolved.Callee = nil
+			sub.Unresolved = append(sub.Unresolved, &unresolved)
+		}
+	}
+	for _, c := range g.Unresolved {
+		if keep(c.Caller) {
+			sub.Unresolved = append(sub.Unresolved, c)
+		}
+	}
+	return sub
+}
+
+// callEdge is the set of calls from a function to another, or to the
+// functions the project does not declare when callee is nil.
+type callEdge struct {
+	caller, callee *Function
+	calls          int
+	lines          []int
+	// names are the names called, for the unresolved calls.
+	names     []string
+	ambiguous bool
+}
+
+// edges groups the calls by caller, callee and whether they are
+// ambiguous, in the order of the first call, and then the unresolved
+// calls by caller.
+func (g *CallGraph) edges() []*callEdge {
+	type key struct {
+		caller, callee *Function
+		ambiguous      bool
+	}
+	var edges []*callEdge
+	index := make(map[key]*callEdge)
+	for _, calls := range [][]*Call{g.Calls, g.Unresolved} {
+		for _, c := range calls {
+			k := key{c.Caller, c.Callee, c.Ambiguous}
+			e, ok := index[k]
+			if !ok {
+				e = &callEdge{caller: c.Caller, callee: c.Callee, ambiguous: c.Ambiguous}
+				index[k] = e
+				edges = append(edges, e)
+			}
+			e.calls++
+			if c.Pos != nil && !containsInt(e.lines, c.Pos.StartLine) {
+				e.lines = append(e.lines, c.Pos.StartLine)
+			}
+			if c.Callee == nil && !containsString(e.names, c.Name) {
+				e.names = append(e.names, c.Name)
+			}
+		}
+	}
+	return edges
+}
+
+// label says how many calls an edge stands for and on which lines, after
+// the names called for the unresolved calls.
+func (e *callEdge) label() string {
+	lines := make([]string, 0, len(e.lines))
+	for _, l := range e.lines {
+		lines = append(lines, fmt.Sprint(l))
+	}
+	where := "lines " + strings.Join(lines, ", ")
+	if len(lines) == 1 {
+		where = "line " + lines[0]
+	}
+	label := where
+	if e.calls > 1 {
+		label = fmt.Sprintf("%d calls, %s", e.calls, where)
+	}
+	if len(e.names) != 0 {
+		label = strings.Join(e.names, ", ") + "\n" + label
+	}
+	return label
+}
+
+func containsInt(list []int, n int) bool {
+	for _, m := range list {
+		if m == n {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, t := range list {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteCallsDot writes the call graph in Graphviz DOT format, an edge per
+// caller and callee labelled with the lines of the calls. Ambiguous
+// calls are dashed, unresolved calls lead to a single dashed node.
+func WriteCallsDot(w io.Writer, g *CallGraph) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "digraph calls {")
+	fmt.Fprintln(out, `  node [fontname="monospace", shape=box];`)
+	fmt.Fprintln(out, `  edge [fontname="monospace"];`)
+	ids := make(map[*Function]string, len(g.Functions))
+	for i, f := range g.Functions {
+		ids[f] = fmt.Sprintf("f%d", i)
+		attrs := "label=" + dotQuote(f.Name)
+		switch f.Kind {
+		case FuncScript:
+			attrs = "shape=note, " + attrs
+		case FuncMethod:
+			attrs = "style=rounded, " + attrs
+		}
+		fmt.Fprintf(out, "  %s [%s];\n", ids[f], attrs)
+	}
+	if len(g.Unresolved) != 0 {
+		ids[nil] = "unresolved"
+		fmt.Fprintln(out, `  unresolved [shape=box, style=dashed, label="unresolved"];`)
+	}
+	for _, e := range g.edges() {
+		style := ""
+		if e.ambiguous {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(out, "  %s -> %s [label=%s%s];\n", ids[e.caller], ids[e.callee], dotQuote(e.label()), style)
+	}
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+// WriteCallsMermaid writes the call graph as a Mermaid flowchart,
+// ambiguous calls as dotted links and unresolved calls to a single
+// hexagon.
+func WriteCallsMermaid(w io.Writer, g *CallGraph) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "flowchart LR")
+	ids := make(map[*Function]string, len(g.Functions))
+	for i, f := range g.Functions {
+		ids[f] = fmt.Sprintf("f%d", i)
+		label := mermaidQuote(f.Name)
+		switch f.Kind {
+		case FuncScript:
+			fmt.Fprintf(out, "  %s[/%s/]\n", ids[f], label)
+		case FuncMethod:
+			fmt.Fprintf(out, "  %s(%s)\n", ids[f], label)
+		default:
+			fmt.Fprintf(out, "  %s[%s]\n", ids[f], label)
+		}
+	}
+	if len(g.Unresolved) != 0 {
+		ids[nil] = "unresolved"
+		fmt.Fprintln(out, `  unresolved{{"unresolved"}}`)
+	}
+	for _, e := range g.edges() {
+		arrow := "-->"
+		if e.ambiguous {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(out, "  %s %s|%s| %s\n", ids[e.caller], arrow, mermaidQuote(e.label()), ids[e.callee])
+	}
+	return out.Flush()
+}
+
+// fileDecls are the declarations and calls of a file.
+type fileDecls struct {
+	file       *SourceFile
+	namespaces []*ast.StmtNamespace
+	functions  []*ast.StmtFunction
+	// classes are the class, interface, trait and enum declarations.
+	classes   []ast.Vertex
+	methods   []*ast.StmtClassMethod
+	traitUses []*ast.StmtTraitUse
+	uses      []useDecl
+	calls     []*ast.ExprFunctionCall
+	// methodCalls are the method, nullsafe method and static calls.
+	methodCalls []ast.Vertex
+	// classNames are the class names of new, instanceof, catch and class
+	// constant and static property fetches.
+	classNames []ast.Vertex
+}
+
+func newFileDecls(f *SourceFile) *fileDecls {
+	d := &fileDecls{file: f}
+	traverser.NewTraverser(&declFinder{decls: d}).Traverse(f.Root)
+	return d
+}
+
+// declFinder fills fileDecls.
+type declFinder struct {
+	visitor.Null
+	decls *fileDecls
+}
+
+func (v *declFinder) StmtNamespace(n *ast.StmtNamespace) {
+	v.decls.namespaces = append(v.decls.namespaces, n)
+}
+
+func (v *declFinder) StmtFunction(n *ast.StmtFunction) {
+	v.decls.functions = append(v.decls.functions, n)
+}
+
+func (v *declFinder) StmtClass(n *ast.StmtClass) {
+	v.decls.classes = append(v.decls.classes, n)
+}
+
+func (v *declFinder) StmtInterface(n *ast.StmtInterface) {
+	v.decls.classes = append(v.decls.classes, n)
+}
+
+func (v *declFinder) StmtTrait(n *ast.StmtTrait) {
+	v.decls.classes = append(v.decls.classes, n)
+}
+
+func (v *declFinder) StmtEnum(n *ast.StmtEnum) {
+	v.decls.classes = append(v.decls.classes, n)
+}
+
+func (v *declFinder) StmtClassMethod(n *ast.StmtClassMethod) {
+	v.decls.methods = append(v.decls.methods, n)
+}
+
+func (v *declFinder) StmtUse(n *ast.StmtUseList) {
+	v.decls.addUses(n.Position, n.Type, nil, n.Uses)
+}
+
+func (v *declFinder) StmtGroupUse(n *ast.StmtGroupUseList) {
+	v.decls.addUses(n.Position, n.Type, n.Prefix, n.Uses)
+}
+
+func (v *declFinder) StmtTraitUse(n *ast.StmtTraitUse) {
+	v.decls.traitUses = append(v.decls.traitUses, n)
+}
+
+func (v *declFinder) ExprFunctionCall(n *ast.ExprFunctionCall) {
+	v.decls.calls = append(v.decls.calls, n)
+}
+
+func (v *declFinder) ExprMethodCall(n *ast.ExprMethodCall) {
+	v.decls.methodCalls = append(v.decls.methodCalls, n)
+}
+
+func (v *declFinder) ExprNullsafeMethodCall(n *ast.ExprNullsafeMethodCall) {
+	v.decls.methodCalls = append(v.decls.methodCalls, n)
+}
+
+func (v *declFinder) ExprStaticCall(n *ast.ExprStaticCall) {
+	v.decls.methodCalls = append(v.decls.methodCalls, n)
+}
+
+func (v *declFinder) ExprNew(n *ast.ExprNew) {
+	v.decls.classNames = append(v.decls.classNames, n.Class)
+}
+
+func (v *declFinder) ExprInstanceOf(n *ast.ExprInstanceOf) {
+	v.decls.classNames = append(v.decls.classNames, n.Class)
+}
+
+func (v *declFinder) ExprClassConstFetch(n *ast.ExprClassConstFetch) {
+	v.decls.classNames = append(v.decls.classNames, n.Class)
+}
+
+func (v *declFinder) ExprStaticPropertyFetch(n *ast.ExprStaticPropertyFetch) {
+	v.decls.classNames = append(v.decls.classNames, n.Class)
+}
+
+func (v *declFinder) StmtCatch(n *ast.StmtCatch) {
+	v.decls.classNames = append(v.decls.classNames, n.Types...)
+}
+
+// methodName returns Class::method for a method, the class with its
+// namespace.
+func (d *fileDecls) methodName(m *ast.StmtClassMethod) string {
+	return d.className(d.classAt(m.Position)) + "::" + nameString(m.Name)
+}
+
+// classAt returns the innermost class declaration holding pos, nil if
+// there is none.
+func (d *fileDecls) classAt(pos *position.Position) ast.Vertex {
+	var inner ast.Vertex
+	for _, c := range d.classes {
+		at := c.GetPosition()
+		if contains(at, pos) && (inner == nil || at.EndPos-at.StartPos < inner.GetPosition().EndPos-inner.GetPosition().StartPos) {
+			inner = c
+		}
+	}
+	return inner
+}
+
+// className returns the name of a class declaration with its namespace,
+// "" for nil. Anonymous classes are named class@anonymous followed by the
+// file and line they are declared at, as PHP does.
+func (d *fileDecls) className(c ast.Vertex) string {
+	if c == nil {
+		return ""
+	}
+	var name ast.Vertex
+	switch c := c.(type) {
+	case *ast.StmtClass:
+		name = c.Name
+	case *ast.StmtInterface:
+		name = c.Name
+	case *ast.StmtTrait:
+		name = c.Name
+	case *ast.StmtEnum:
+		name = c.Name
+	}
+	if name == nil {
+		return "class@anonymous@" + d.at(c.GetPosition())
+	}
+	return d.qualify(nameString(name), c.GetPosition())
+}
+
+// closureName returns the name of a closure or arrow function,
+// {closure} followed by the file and line it is written at.
+func (d *fileDecls) closureName(n ast.Vertex) string {
+	return "{closure}@" + d.at(n.GetPosition())
+}
+
+// at returns the file name and line of pos, for the names of what is
+// declared without one.
+func (d *fileDecls) at(pos *position.Position) string {
+	return fmt.Sprintf("%s:%d", filepath.Base(d.file.Path), pos.StartLine)
+}
+
+// contains tells whether outer holds inner.
+func contains(outer, inner *position.Position) bool {
+	return outer != nil && inner != nil && outer.StartPos <= inner.StartPos && inner.EndPos <= outer.EndPos
+}
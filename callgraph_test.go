@@ -0,0 +1,131 @@
+package visualizephp
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// loadFiles writes files to dir and loads them as a project.
+func loadFiles(t *testing.T, dir string, files map[string]string) *Project {
+	t.Helper()
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := LoadProject(dir, "8.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestBuildCallGraph(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.php": `<?php
+namespace App;
+
+use function Lib\helper as h;
+
+function strlen($s) { return 0; }
+
+function main() {
+    strlen("x");
+    count([]);
+    h();
+    \Lib\helper();
+    Cart::make();
+    $cart->total();
+    $f();
+}
+
+abstract class Base {
+    function save() {}
+    abstract function total();
+}
+
+class Cart extends Base {
+    static function make() { return new static(); }
+    function total() { $this->save(); parent::save(); }
+}
+`,
+		"lib.php": `<?php
+namespace Lib;
+
+function helper() {}
+`,
+	}
+	g := BuildCallGraph(loadFiles(t, dir, files))
+
+	calls := map[string]string{}
+	for _, c := range g.Calls {
+		callee := c.Callee.Name
+		if c.Ambiguous {
+			callee += " (ambiguous)"
+		}
+		calls[c.Caller.Name+" "+c.Name] = callee
+	}
+	tests := []struct {
+		caller, name string
+		want         string
+	}{
+		// the current namespace comes before the global one
+		{`App\main`, "strlen", `App\strlen`},
+		{`App\main`, "h", `Lib\helper`},
+		{`App\main`, `\Lib\helper`, `Lib\helper`},
+		{`App\main`, "Cart::make", `App\Cart::make`},
+		// the abstract method is left out when a class implements it
+		{`App\main`, "->total", `App\Cart::total (ambiguous)`},
+		{`App\Cart::total`, "$this->save", `App\Base::save`},
+		{`App\Cart::total`, "parent::save", `App\Base::save`},
+	}
+	for _, tt := range tests {
+		if got := calls[tt.caller+" "+tt.name]; got != tt.want {
+			t.Errorf("%s calling %s: got %q, want %q", tt.caller, tt.name, got, tt.want)
+		}
+	}
+	if len(g.Calls) != len(tests) {
+		t.Errorf("got %d calls, want %d: %v", len(g.Calls), len(tests), calls)
+	}
+
+	var unresolved []string
+	for _, c := range g.Unresolved {
+		unresolved = append(unresolved, c.Caller.Name+" "+c.Name)
+	}
+	sort.Strings(unresolved)
+	if got, want := unresolved, []string{`App\main $f`, `App\main count`}; !equalStrings(got, want) {
+		t.Errorf("got unresolved calls %q, want %q", got, want)
+	}
+}
+
+func TestBuildCallGraphParentOutsideClass(t *testing.T) {
+	g := BuildCallGraph(loadFiles(t, t.TempDir(), map[string]string{
+		"main.php": `<?php
+parent::foo();
+$f = function () { parent::bar(); };
+`,
+	}))
+	var unresolved []string
+	for _, c := range g.Unresolved {
+		unresolved = append(unresolved, c.Name)
+	}
+	sort.Strings(unresolved)
+	if want := []string{"parent::bar", "parent::foo"}; !equalStrings(unresolved, want) {
+		t.Errorf("got unresolved calls %q, want %q", unresolved, want)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
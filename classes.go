@@ -0,0 +1,658 @@
+package visualizephp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/VKCOM/php-parser/pkg/ast"
+	"github.com/VKCOM/php-parser/pkg/position"
+)
+
+// ClassKind tells classes, interfaces, traits and enums apart.
+type ClassKind int
+
+const (
+	KindClass ClassKind = iota
+	KindInterface
+	KindTrait
+	KindEnum
+)
+
+func (k ClassKind) String() string {
+	switch k {
+	case KindInterface:
+		return "interface"
+	case KindTrait:
+		return "trait"
+	case KindEnum:
+		return "enum"
+	}
+	return "class"
+}
+
+// Class is a class, interface, trait or enum declaration.
+type Class struct {
+	// Name is the name with its namespace.
+	Name     string    `json:"name"`
+	Kind     ClassKind `json:"kind"`
+	Abstract bool      `json:"abstract,omitempty"`
+	Final    bool      `json:"final,omitempty"`
+	// Extends holds the parent class, or the interfaces an interface
+	// extends. Extends, Implements and Uses hold names with their
+	// namespace.
+	Extends    []string  `json:"extends,omitempty"`
+	Implements []string  `json:"implements,omitempty"`
+	Uses       []string  `json:"uses,omitempty"`
+	Constants  []*Member `json:"constants,omitempty"`
+	Properties []*Member `json:"properties,omitempty"`
+	Methods    []*Method `json:"methods,omitempty"`
+	// Cases are the cases of an enum, Type the type of their values for
+	// a backed enum.
+	Cases []*Member `json:"cases,omitempty"`
+	Type  string    `json:"type,omitempty"`
+	// File and Pos are written by MarshalJSON.
+	File *SourceFile        `json:"-"`
+	Pos  *position.Position `json:"-"`
+}
+
+// Member is a property, a class constant or an enum case.
+type Member struct {
+	Name string `json:"name"`
+	// Visibility is public, protected or private.
+	Visibility string `json:"visibility,omitempty"`
+	Static     bool   `json:"static,omitempty"`
+	Readonly   bool   `json:"readonly,omitempty"`
+	// Type and Value are PHP source, empty when not given.
+	Type  string `json:"type,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// Method is a method signature.
+type Method struct {
+	Name       string   `json:"name"`
+	Visibility string   `json:"visibility,omitempty"`
+	Static     bool     `json:"static,omitempty"`
+	Abstract   bool     `json:"abstract,omitempty"`
+	Final      bool     `json:"final,omitempty"`
+	Params     []*Param `json:"params,omitempty"`
+	// Returns is the return type as written, empty when not given.
+	Returns string `json:"returns,omitempty"`
+}
+
+// Param is a function or method parameter.
+type Param struct {
+	// Name is the name without $.
+	Name     string `json:"name"`
+	Type     string `json:"type,omitempty"`
+	Default  string `json:"default,omitempty"`
+	ByRef    bool   `json:"byRef,omitempty"`
+	Variadic bool   `json:"variadic,omitempty"`
+}
+
+// ClassDiagram holds the classes of a project.
+type ClassDiagram struct {
+	Classes []*Class `json:"classes"`
+}
+
+// BuildClassDiagram reads the class, interface, trait and enum
+// declarations of the project. Anonymous classes are left out, and so are
+// the classes of the vendor directory when p.ExcludeVendor is set: they
+// are drawn like classes from outside the project.
+func BuildClassDiagram(p *Project) *ClassDiagram {
+	d := &ClassDiagram{}
+	seen := make(map[string]bool)
+	for _, f := range p.Files {
+		if f.Root == nil || !p.drawn(f) {
+			continue
+		}
+		decls := newFileDecls(f)
+		for _, c := range decls.classes {
+			if c, ok := c.(*ast.StmtClass); ok && c.Name == nil {
+				continue
+			}
+			class := decls.class(c)
+			// declared twice, conditionally or by mistake, the first wins
+			if key := strings.ToLower(class.Name); !seen[key] {
+				seen[key] = true
+				d.Classes = append(d.Classes, class)
+			}
+		}
+	}
+	return d
+}
+
+// class reads the declaration c of the file of d.
+func (d *fileDecls) class(c ast.Vertex) *Class {
+	class := &Class{Name: d.className(c), File: d.file, Pos: c.GetPosition()}
+	refs := func(names []ast.Vertex) []string {
+		var refs []string
+		for _, n := range names {
+			refs = append(refs, d.classRef(nameString(n), c.GetPosition()))
+		}
+		return refs
+	}
+	var stmts []ast.Vertex
+	switch c := c.(type) {
+	case *ast.StmtClass:
+		for _, m := range c.Modifiers {
+			switch strings.ToLower(nameString(m)) {
+			case "abstract":
+				class.Abstract = true
+			case "final":
+				class.Final = true
+			}
+		}
+		if c.Extends != nil {
+			class.Extends = refs([]ast.Vertex{c.Extends})
+		}
+		class.Implements = refs(c.Implements)
+		stmts = c.Stmts
+	case *ast.StmtInterface:
+		class.Kind = KindInterface
+		class.Extends = refs(c.Extends)
+		stmts = c.Stmts
+	case *ast.StmtTrait:
+		class.Kind = KindTrait
+		stmts = c.Stmts
+	case *ast.StmtEnum:
+		class.Kind = KindEnum
+		class.Type = typeText(d.file.Src, c.Type)
+		class.Implements = refs(c.Implements)
+		stmts = c.Stmts
+	}
+
+	src := d.file.Src
+	for _, stmt := range stmts {
+		switch n := stmt.(type) {
+		case *ast.StmtTraitUse:
+			class.Uses = append(class.Uses, refs(n.Traits)...)
+		case *ast.StmtClassConstList:
+			for _, v := range n.Consts {
+				m := &Member{Visibility: "public"}
+				setModifiers(m, n.Modifiers)
+				if v, ok := v.(*ast.StmtConstant); ok {
+					m.Name, m.Value = nameString(v.Name), printPHP(src, v.Expr)
+				}
+				class.Constants = append(class.Constants, m)
+			}
+		case *ast.StmtPropertyList:
+			for _, v := range n.Props {
+				m := &Member{Visibility: "public", Type: typeText(src, n.Type)}
+				setModifiers(m, n.Modifiers)
+				if v, ok := v.(*ast.StmtProperty); ok {
+					m.Name = strings.TrimPrefix(variableName(v.Var), "$")
+					if v.Expr != nil {
+						m.Value = printPHP(src, v.Expr)
+					}
+				}
+				class.Properties = append(class.Properties, m)
+			}
+		case *ast.EnumCase:
+			m := &Member{Name: nameString(n.Name)}
+			if n.Expr != nil {
+				m.Value = printPHP(src, n.Expr)
+			}
+			class.Cases = append(class.Cases, m)
+		case *ast.StmtClassMethod:
+			class.Methods = append(class.Methods, d.method(class, n))
+		}
+	}
+	return class
+}
+
+// method reads the signature of a method of class. The parameters of a
+// constructor promoted to properties are added to the properties of
+// class.
+func (d *fileDecls) method(class *Class, n *ast.StmtClassMethod) *Method {
+	src := d.file.Src
+	m := &Method{Name: nameString(n.Name), Visibility: "public", Returns: typeText(src, n.ReturnType)}
+	for _, mod := range n.Modifiers {
+		switch v := strings.ToLower(nameString(mod)); v {
+		case "public", "protected", "private":
+			m.Visibility = v
+		case "static":
+			m.Static = true
+		case "abstract":
+			m.Abstract = true
+		case "final":
+			m.Final = true
+		}
+	}
+	// methods of interfaces have no body but are not declared abstract
+	if class.Kind == KindInterface {
+		m.Abstract = true
+	}
+	for _, p := range n.Params {
+		p, ok := p.(*ast.Parameter)
+		if !ok {
+			continue
+		}
+		param := newParam(src, p)
+		m.Params = append(m.Params, param)
+		if len(p.Modifiers) != 0 {
+			prop := &Member{Name: param.Name, Visibility: "public", Type: param.Type}
+			setModifiers(prop, p.Modifiers)
+			class.Properties = append(class.Properties, prop)
+		}
+	}
+	return m
+}
+
+func newParam(src []byte, p *ast.Parameter) *Param {
+	return &Param{
+		Name:     strings.TrimPrefix(variableName(p.Var), "$"),
+		Type:     typeText(src, p.Type),
+		Default:  printPHP(src, p.DefaultValue),
+		ByRef:    p.AmpersandTkn != nil,
+		Variadic: p.VariadicTkn != nil,
+	}
+}
+
+// newParams returns the parameters of a function.
+func newParams(src []byte, params []ast.Vertex) []*Param {
+	var result []*Param
+	for _, p := range params {
+		if p, ok := p.(*ast.Parameter); ok {
+			result = append(result, newParam(src, p))
+		}
+	}
+	return result
+}
+
+// setModifiers sets the visibility and flags of m from its modifiers.
+func setModifiers(m *Member, modifiers []ast.Vertex) {
+	for _, mod := range modifiers {
+		switch v := strings.ToLower(nameString(mod)); v {
+		case "public", "protected", "private":
+			m.Visibility = v
+		case "static":
+			m.Static = true
+		case "readonly":
+			m.Readonly = true
+		}
+	}
+}
+
+// typeText returns a type declaration, "" when there is none.
+func typeText(src []byte, n ast.Vertex) string {
+	return printPHP(src, n)
+}
+
+// variableName returns the name of a plain variable with its $.
+func variableName(n ast.Vertex) string {
+	if v, ok := n.(*ast.ExprVariable); ok {
+		return nameString(v.Name)
+	}
+	return ""
+}
+
+// Signature returns the parameters and return type of m as written in
+// PHP, without the name: (int $a, string ...$rest): bool.
+func (m *Method) Signature() string {
+	sig := "(" + m.params() + ")"
+	if m.Returns != "" {
+		sig += ": " + m.Returns
+	}
+	return sig
+}
+
+// params returns the parameters of m as written in PHP, defaults
+// included, for every format to show them alike.
+func (m *Method) params() string {
+	var params []string
+	for _, p := range m.Params {
+		s := "$" + p.Name
+		if p.Variadic {
+			s = "..." + s
+		}
+		if p.ByRef {
+			s = "&" + s
+		}
+		if p.Type != "" {
+			s = p.Type + " " + s
+		}
+		if p.Default != "" {
+			s += " = " + p.Default
+		}
+		params = append(params, s)
+	}
+	return strings.Join(params, ", ")
+}
+
+// umlVisibility returns the UML mark of a visibility.
+func umlVisibility(v string) string {
+	switch v {
+	case "private":
+		return "-"
+	case "protected":
+		return "#"
+	}
+	return "+"
+}
+
+// classRelation is an arrow of a class diagram, from the class to its
+// parent, an interface or a trait.
+type classRelation struct {
+	from, to string
+	kind     string // extends, implements or uses
+}
+
+// relations returns the relations of the diagram and the names they
+// point to that are not classes of the diagram, such as the ones of PHP
+// or of libraries left out, in order.
+func (d *ClassDiagram) relations() ([]classRelation, []string) {
+	known := make(map[string]bool)
+	for _, c := range d.Classes {
+		known[strings.ToLower(c.Name)] = true
+	}
+	var rels []classRelation
+	var external []string
+	add := func(c *Class, names []string, kind string) {
+		for _, n := range names {
+			rels = append(rels, classRelation{c.Name, n, kind})
+			if key := strings.ToLower(n); !known[key] {
+				known[key] = true
+				external = append(external, n)
+			}
+		}
+	}
+	for _, c := range d.Classes {
+		add(c, c.Extends, "extends")
+		add(c, c.Implements, "implements")
+		add(c, c.Uses, "uses")
+	}
+	return rels, external
+}
+
+// ids returns the node ids of the classes and external names, by lower
+// case name.
+func (d *ClassDiagram) ids(external []string) map[string]string {
+	ids := make(map[string]string)
+	for i, c := range d.Classes {
+		ids[strings.ToLower(c.Name)] = fmt.Sprintf("c%d", i)
+	}
+	for i, n := range external {
+		ids[strings.ToLower(n)] = fmt.Sprintf("x%d", i)
+	}
+	return ids
+}
+
+// WriteClassesDot writes the class diagram in Graphviz DOT format, each
+// class as a record of its name, constants and properties, and methods.
+// Classes extended, implemented or used from outside the diagram are
+// drawn as dashed boxes.
+func WriteClassesDot(w io.Writer, d *ClassDiagram) error {
+	out := bufio.NewWriter(w)
+	rels, external := d.relations()
+	ids := d.ids(external)
+	fmt.Fprintln(out, "digraph classes {")
+	fmt.Fprintln(out, "  rankdir=BT;")
+	fmt.Fprintln(out, `  node [fontname="monospace", shape=record];`)
+	fmt.Fprintln(out, `  edge [fontname="monospace"];`)
+	for _, c := range d.Classes {
+		var fields, methods []string
+		for _, m := range c.Cases {
+			fields = append(fields, dotRecordEscape(umlCase(m))+`\l`)
+		}
+		for _, m := range c.Constants {
+			fields = append(fields, dotRecordEscape(umlVisibility(m.Visibility)+umlConstant(m))+`\l`)
+		}
+		for _, m := range c.Properties {
+			fields = append(fields, dotRecordEscape(umlVisibility(m.Visibility)+umlProperty(m))+`\l`)
+		}
+		for _, m := range c.Methods {
+			methods = append(methods, dotRecordEscape(umlVisibility(m.Visibility)+umlMethod(m))+`\l`)
+		}
+		label := fmt.Sprintf("{%s|%s|%s}", dotRecordEscape(umlTitle(c)), strings.Join(fields, ""), strings.Join(methods, ""))
+		fmt.Fprintf(out, "  %s [label=\"%s\"];\n", ids[strings.ToLower(c.Name)], label)
+	}
+	for _, n := range external {
+		fmt.Fprintf(out, "  %s [shape=box, style=dashed, label=%s];\n", ids[strings.ToLower(n)], dotQuote(n))
+	}
+	for _, r := range rels {
+		attrs := "arrowhead=empty"
+		switch r.kind {
+		case "implements":
+			attrs += ", style=dashed"
+		case "uses":
+			attrs = `arrowhead=open, style=dotted, label="use"`
+		}
+		fmt.Fprintf(out, "  %s -> %s [%s];\n", ids[strings.ToLower(r.from)], ids[strings.ToLower(r.to)], attrs)
+	}
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+// umlTitle returns the name of c with its stereotype.
+func umlTitle(c *Class) string {
+	switch {
+	case c.Kind == KindEnum && c.Type != "":
+		return "«enum»\n" + c.Name + ": " + c.Type
+	case c.Kind != KindClass:
+		return "«" + c.Kind.String() + "»\n" + c.Name
+	case c.Abstract:
+		return "«abstract»\n" + c.Name
+	case c.Final:
+		return "«final»\n" + c.Name
+	}
+	return c.Name
+}
+
+func umlProperty(m *Member) string {
+	s := "$" + m.Name
+	if m.Type != "" {
+		s += ": " + m.Type
+	}
+	if m.Value != "" {
+		s += " = " + m.Value
+	}
+	return umlFlags(s, m.Static, m.Readonly, false)
+}
+
+func umlConstant(m *Member) string {
+	return "const " + m.Name + " = " + m.Value
+}
+
+func umlCase(m *Member) string {
+	if m.Value == "" {
+		return "case " + m.Name
+	}
+	return "case " + m.Name + " = " + m.Value
+}
+
+func umlMethod(m *Method) string {
+	return umlFlags(m.Name+m.Signature(), m.Static, false, m.Abstract)
+}
+
+// umlFlags appends the modifiers UML has no notation for in DOT and
+// Mermaid labels.
+func umlFlags(s string, static, readonly, abstract bool) string {
+	var flags []string
+	if static {
+		flags = append(flags, "static")
+	}
+	if readonly {
+		flags = append(flags, "readonly")
+	}
+	if abstract {
+		flags = append(flags, "abstract")
+	}
+	if len(flags) == 0 {
+		return s
+	}
+	return s + " {" + strings.Join(flags, ", ") + "}"
+}
+
+// dotRecordEscape escapes the characters with a meaning in record labels,
+// with new lines centred.
+func dotRecordEscape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"{", `\{`,
+		"}", `\}`,
+		"|", `\|`,
+		"<", `\<`,
+		">", `\>`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// WriteClassesMermaid writes the class diagram as a Mermaid
+// classDiagram. Parameters are written without their default values.
+func WriteClassesMermaid(w io.Writer, d *ClassDiagram) error {
+	out := bufio.NewWriter(w)
+	rels, external := d.relations()
+	ids := d.ids(external)
+	fmt.Fprintln(out, "classDiagram")
+	for _, c := range d.Classes {
+		id := ids[strings.ToLower(c.Name)]
+		fmt.Fprintf(out, "  class %s[%s]\n", id, mermaidQuote(c.Name))
+		switch {
+		case c.Kind == KindEnum:
+			fmt.Fprintf(out, "  <<enumeration>> %s\n", id)
+		case c.Kind != KindClass:
+			fmt.Fprintf(out, "  <<%s>> %s\n", c.Kind, id)
+		case c.Abstract:
+			fmt.Fprintf(out, "  <<abstract>> %s\n", id)
+		}
+		for _, m := range c.Cases {
+			fmt.Fprintf(out, "  %s : %s\n", id, umlCase(m))
+		}
+		for _, m := range c.Constants {
+			fmt.Fprintf(out, "  %s : %s%s\n", id, umlVisibility(m.Visibility), umlConstant(m))
+		}
+		for _, m := range c.Properties {
+			s := "$" + m.Name
+			if m.Type != "" {
+				s = m.Type + " " + s
+			}
+			fmt.Fprintf(out, "  %s : %s%s%s\n", id, umlVisibility(m.Visibility), s, mermaidClassifier(m.Static, false))
+		}
+		for _, m := range c.Methods {
+			fmt.Fprintf(out, "  %s : %s%s(%s)%s", id, umlVisibility(m.Visibility), m.Name, m.params(), mermaidClassifier(m.Static, m.Abstract))
+			if m.Returns != "" {
+				fmt.Fprintf(out, " %s", m.Returns)
+			}
+			fmt.Fprintln(out)
+		}
+	}
+	for _, n := range external {
+		fmt.Fprintf(out, "  class %s[%s]\n", ids[strings.ToLower(n)], mermaidQuote(n))
+	}
+	for _, r := range rels {
+		arrow := "<|--"
+		switch r.kind {
+		case "implements":
+			arrow = "<|.."
+		case "uses":
+			arrow = "<.."
+		}
+		fmt.Fprintf(out, "  %s %s %s", ids[strings.ToLower(r.to)], arrow, ids[strings.ToLower(r.from)])
+		if r.kind == "uses" {
+			fmt.Fprint(out, " : use")
+		}
+		fmt.Fprintln(out)
+	}
+	return out.Flush()
+}
+
+// mermaidClassifier returns the Mermaid mark of static and abstract
+// members.
+func mermaidClassifier(static, abstract bool) string {
+	switch {
+	case static:
+		return "$"
+	case abstract:
+		return "*"
+	}
+	return ""
+}
+
+// WriteClassesPlantUML writes the class diagram as a PlantUML class
+// diagram.
+func WriteClassesPlantUML(w io.Writer, d *ClassDiagram) error {
+	out := bufio.NewWriter(w)
+	rels, external := d.relations()
+	ids := d.ids(external)
+	fmt.Fprintln(out, "@startuml")
+	fmt.Fprintln(out, "hide empty members")
+	for _, c := range d.Classes {
+		keyword := "class"
+		switch {
+		case c.Kind == KindInterface:
+			keyword = "interface"
+		case c.Kind == KindEnum:
+			keyword = "enum"
+		case c.Abstract:
+			keyword = "abstract class"
+		}
+		stereotype := ""
+		switch {
+		case c.Kind == KindTrait:
+			stereotype = " <<trait>>"
+		case c.Final:
+			stereotype = " <<final>>"
+		}
+		fmt.Fprintf(out, "%s \"%s\" as %s%s {\n", keyword, c.Name, ids[strings.ToLower(c.Name)], stereotype)
+		for _, m := range c.Cases {
+			if m.Value == "" {
+				fmt.Fprintf(out, "  %s\n", m.Name)
+			} else {
+				fmt.Fprintf(out, "  %s = %s\n", m.Name, m.Value)
+			}
+		}
+		for _, m := range c.Constants {
+			fmt.Fprintf(out, "  {static} %s%s = %s\n", umlVisibility(m.Visibility), m.Name, m.Value)
+		}
+		for _, m := range c.Properties {
+			fmt.Fprintf(out, "  %s%s$%s", plantUMLModifier(m.Static, false), umlVisibility(m.Visibility), m.Name)
+			if m.Type != "" {
+				fmt.Fprintf(out, " : %s", m.Type)
+			}
+			if m.Readonly {
+				fmt.Fprint(out, " {readOnly}")
+			}
+			fmt.Fprintln(out)
+		}
+		for _, m := range c.Methods {
+			fmt.Fprintf(out, "  %s%s%s(%s)", plantUMLModifier(m.Static, m.Abstract), umlVisibility(m.Visibility), m.Name, m.params())
+			if m.Returns != "" {
+				fmt.Fprintf(out, " : %s", m.Returns)
+			}
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintln(out, "}")
+	}
+	for _, n := range external {
+		fmt.Fprintf(out, "class \"%s\" as %s #line.dashed\n", n, ids[strings.ToLower(n)])
+	}
+	for _, r := range rels {
+		arrow := "<|--"
+		switch r.kind {
+		case "implements":
+			arrow = "<|.."
+		case "uses":
+			arrow = "<.."
+		}
+		fmt.Fprintf(out, "%s %s %s", ids[strings.ToLower(r.to)], arrow, ids[strings.ToLower(r.from)])
+		if r.kind == "uses" {
+			fmt.Fprint(out, " : use")
+		}
+		fmt.Fprintln(out)
+	}
+	fmt.Fprintln(out, "@enduml")
+	return out.Flush()
+}
+
+func plantUMLModifier(static, abstract bool) string {
+	switch {
+	case static:
+		return "{static} "
+	case abstract:
+		return "{abstract} "
+	}
+	return ""
+}
@@ -1 +1,349 @@
+// Command visualize draws PHP source as flowcharts and diagrams.
+//
+//	visualize [command] [flags] file.php
+//
+// The command is one of flow (the default), includes, calls, classes or
+// ast. Flags may come before or after the file.
 package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/VKCOM/php-parser/pkg/ast"
+	visualizephp "github.com/joshatoutthink/visualizePhp"
+)
+
+// Exit codes.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+const usage = `usage: visualize [command] [flags] file.php
+       visualize calls|classes [flags] file.php|directory
+
+commands:
+  flow     control flow of the file and of each function, method and
+           closure (default)
+  includes files reached through include and require
+  calls    call graph of the functions of a file and the files it
+           includes, or of every PHP file under a directory
+  classes  class diagram of a file and the files it includes, or of
+           every PHP file under a directory
+  ast      outline of the syntax tree
+
+flags:
+`
+
+// options are the flags shared by every command.
+type options struct {
+	format string
+	output string
+	php    string
+	entry  string
+	to     string
+	depth  int
+	inline bool
+	expand int
+	labels visualizephp.LabelFormat
+	// noVendor leaves the files under vendor/ out of calls and classes.
+	noVendor bool
+	// stderr gets the warnings.
+	stderr io.Writer
+}
+
+// A command writes its drawing of the file, or directory for calls, to out.
+type command func(opts *options, file string, out io.Writer) error
+
+var commands = map[string]command{
+	"flow":     flowCommand,
+	"includes": includesCommand,
+	"calls":    callsCommand,
+	"classes":  classesCommand,
+	"ast":      astCommand,
+}
+
+// formatExtensions maps output file extensions to formats.
+var formatExtensions = map[string]string{
+	".dot":  "dot",
+	".gv":   "dot",
+	".mmd":  "mermaid",
+	".puml": "plantuml",
+	".html": "html",
+	".svg":  "svg",
+	".json": "json",
+	".txt":  "text",
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	name := "flow"
+	if len(args) > 0 {
+		if _, ok := commands[args[0]]; ok {
+			name, args = args[0], args[1:]
+		}
+	}
+
+	opts := &options{stderr: stderr}
+	fs := flag.NewFlagSet("visualize "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&opts.format, "format", "", "output format: dot, mermaid, plantuml, html or svg for flow, dot or mermaid for includes and calls, dot, mermaid or plantuml for classes, json for all of these, text for ast (default from the -o extension)")
+	fs.StringVar(&opts.output, "o", "", "output file (default stdout)")
+	fs.StringVar(&opts.php, "php", "", "PHP version of the source (default from a visualize-php comment or composer.json, 7.4 otherwise)")
+	fs.StringVar(&opts.entry, "entry", "", "function to draw, {main} for the top level of the file (default all)")
+	fs.BoolVar(&opts.inline, "inline-includes", false, "flow: draw the files included by include and require where they are included")
+	fs.BoolVar(&opts.noVendor, "exclude-vendor", false, "calls, classes: leave the files under vendor/ out of the drawing, still reading them to resolve names")
+	fs.StringVar(&opts.to, "to", "", "calls: draw the functions calling this one")
+	fs.IntVar(&opts.expand, "expand-calls", 0, "flow: draw the body of the functions of the file where they are called, this many calls deep")
+	fs.IntVar(&opts.labels.MaxLength, "max-label", 0, "flow: cut label lines longer than this many characters, 0 for no limit")
+	fs.IntVar(&opts.labels.Width, "wrap", 0, "flow: wrap label lines at this many characters, 0 for no wrapping")
+	fs.IntVar(&opts.depth, "depth", 0, "how many levels to draw below the entry, or above the -to function, 0 for no limit")
+
+	file, err := parseArgs(fs, args)
+	var argsErr argsError
+	switch {
+	case err == flag.ErrHelp:
+		return exitOK
+	case errors.As(err, &argsErr):
+		fmt.Fprintf(stderr, "visualize: %v\n", err)
+		fs.Usage()
+		return exitUsage
+	case err != nil:
+		// the flag set printed the error and the usage already
+		return exitUsage
+	}
+	if opts.depth < 0 {
+		fmt.Fprintf(stderr, "visualize: -depth must not be negative\n")
+		return exitUsage
+	}
+	if opts.format == "" {
+		opts.format = formatExtensions[filepath.Ext(opts.output)]
+	}
+
+	// the drawing is kept in memory so a failed command leaves no partial
+	// output file behind
+	var out bytes.Buffer
+	if err := commands[name](opts, file, &out); err != nil {
+		fmt.Fprintf(stderr, "visualize %s: %v\n", name, err)
+		return exitError
+	}
+
+	if opts.output == "" {
+		_, err = out.WriteTo(stdout)
+	} else {
+		err = ioutil.WriteFile(opts.output, out.Bytes(), 0666)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "visualize: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// parseArgs parses the flags, which may come before or after the PHP
+// file as in "visualize entrypoint.php -o flow.svg", and returns the file.
+func parseArgs(fs *flag.FlagSet, args []string) (string, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	var files []string
+	for fs.NArg() > 0 {
+		files = append(files, fs.Arg(0))
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return "", err
+		}
+	}
+	switch len(files) {
+	case 0:
+		return "", argsError("no PHP file given")
+	case 1:
+		return files[0], nil
+	default:
+		return "", argsError(fmt.Sprintf("expected a single PHP file, got %d", len(files)))
+	}
+}
+
+// argsError is a mistake in the arguments found by parseArgs rather than
+// by the flag set, which reports its own.
+type argsError string
+
+func (e argsError) Error() string {
+	return string(e)
+}
+
+// parse parses src with the version picked for file, naming file in the
+// error. Syntax errors the parser recovered from are reported to stderr
+// and returned along with the tree, drawn as unparseable nodes.
+func parse(opts *options, file string, src []byte) (*ast.Root, visualizephp.ParseErrors, error) {
+	v, err := visualizephp.PHPVersion(file, src, opts.php)
+	if err != nil {
+		return nil, nil, err
+	}
+	root, err := visualizephp.ParseFile(src, v)
+	if err := parsed(opts, file, err, root != nil); err != nil {
+		return nil, nil, err
+	}
+	errs, _ := err.(visualizephp.ParseErrors)
+	return root, errs, nil
+}
+
+// parsed reports the syntax errors in err, as ParseFile and BuildFlow
+// return it for file, to stderr. ok tells whether the file was parsed
+// all the same; when it was not, parsed returns the error to fail with.
+func parsed(opts *options, file string, err error, ok bool) error {
+	errs, _ := err.(visualizephp.ParseErrors)
+	for _, e := range errs {
+		sep := ":"
+		if e.Line == 0 {
+			sep = ": "
+		}
+		fmt.Fprintf(opts.stderr, "%s%s%v\n%s", file, sep, e, e.Frame)
+	}
+	switch {
+	case ok:
+		return nil
+	case errs != nil:
+		return fmt.Errorf("%s: cannot be parsed", file)
+	}
+	return fmt.Errorf("%s: %v", file, err)
+}
+
+// render draws d in the format of the flags, DOT when none is given.
+func render(opts *options, out io.Writer, d visualizephp.Diagram) error {
+	format := opts.format
+	if format == "" {
+		format = "dot"
+	}
+	r := visualizephp.LookupRenderer(format)
+	if r == nil {
+		return fmt.Errorf("unknown format %q", opts.format)
+	}
+	return r.Render(out, d)
+}
+
+func flowCommand(opts *options, file string, out io.Writer) error {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	flow, err := visualizephp.BuildFlow(file, src, visualizephp.Options{
+		PHPVersion:     opts.php,
+		InlineIncludes: opts.inline,
+		ExpandCalls:    opts.expand,
+		Labels:         opts.labels,
+	})
+	if err := parsed(opts, file, err, flow != nil); err != nil {
+		return err
+	}
+
+	if opts.entry != "" {
+		if flow = flow.Only(opts.entry); flow == nil {
+			return fmt.Errorf("%s: no function %s", file, opts.entry)
+		}
+	}
+	return render(opts, out, flow)
+}
+
+func includesCommand(opts *options, file string, out io.Writer) error {
+	g, err := visualizephp.BuildIncludeGraph(file, opts.php)
+	if err != nil {
+		return err
+	}
+	for _, f := range g.Files {
+		for _, e := range f.Errors {
+			fmt.Fprintf(opts.stderr, "%s:%v\n", f.Path, e)
+		}
+		if f.Err != nil && !f.Missing {
+			fmt.Fprintf(opts.stderr, "%v\n", f.Err)
+		}
+	}
+	return render(opts, out, g)
+}
+
+// loadProject loads the files under a directory, or a file and the files
+// it includes, reporting the files that cannot be read or parsed.
+func loadProject(opts *options, file string) (*visualizephp.Project, error) {
+	p, err := visualizephp.LoadProject(file, opts.php)
+	if err != nil {
+		return nil, err
+	}
+	p.ExcludeVendor = opts.noVendor
+	for _, f := range p.Files {
+		for _, e := range f.Errors {
+			fmt.Fprintf(opts.stderr, "%s:%v\n", f.Path, e)
+		}
+		if f.Err != nil && !f.Missing {
+			fmt.Fprintf(opts.stderr, "%v\n", f.Err)
+		}
+	}
+	return p, nil
+}
+
+// callsCommand draws the calls between the functions of the files under
+// a directory, or of a file and the files it includes.
+func callsCommand(opts *options, file string, out io.Writer) error {
+	if opts.entry != "" && opts.to != "" {
+		return errors.New("-entry and -to cannot be used together")
+	}
+	p, err := loadProject(opts, file)
+	if err != nil {
+		return err
+	}
+	g := visualizephp.BuildCallGraph(p)
+	switch {
+	case opts.entry != "":
+		f := g.Function(opts.entry)
+		if f == nil {
+			return fmt.Errorf("%s: no function %s", file, opts.entry)
+		}
+		g = g.From(f, opts.depth)
+	case opts.to != "":
+		f := g.Function(opts.to)
+		if f == nil {
+			return fmt.Errorf("%s: no function %s", file, opts.to)
+		}
+		g = g.To(f, opts.depth)
+	}
+	return render(opts, out, g)
+}
+
+// classesCommand draws the classes of the files under a directory, or of
+// a file and the files it includes.
+func classesCommand(opts *options, file string, out io.Writer) error {
+	p, err := loadProject(opts, file)
+	if err != nil {
+		return err
+	}
+	d := visualizephp.BuildClassDiagram(p)
+	return render(opts, out, d)
+}
+
+func astCommand(opts *options, file string, out io.Writer) error {
+	if opts.format != "" && opts.format != "text" {
+		return fmt.Errorf("unknown format %q", opts.format)
+	}
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	root, _, err := parse(opts, file, src)
+	if err != nil {
+		return err
+	}
+	return visualizephp.WriteAST(out, root, opts.depth)
+}
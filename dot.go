@@ -0,0 +1,146 @@
+package visualizephp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDot writes the flow as a Graphviz digraph, one cluster per graph.
+// Node IDs are made of the graph name and the node number so they stay
+// the same between runs, the id attributes carried into SVG output are
+// the node keys used by the other formats.
+func WriteDot(w io.Writer, flow *Flow) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "digraph flow {")
+	fmt.Fprintln(out, `  node [fontname="monospace"];`)
+	fmt.Fprintln(out, `  edge [fontname="monospace"];`)
+	for i, g := range flow.Graphs {
+		fmt.Fprintf(out, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(out, "    id=\"g%d\";\n", i)
+		fmt.Fprintf(out, "    label=%s;\n", dotQuote(g.Name))
+		writeDotNodes(out, i, g, nil, "    ")
+		for _, e := range g.Edges {
+			fmt.Fprintf(out, "    %s -> %s", dotID(g, e.From), dotID(g, e.To))
+			if attrs := dotEdgeAttrs(e); attrs != "" {
+				fmt.Fprintf(out, " [%s]", attrs)
+			}
+			fmt.Fprintln(out, ";")
+		}
+		fmt.Fprintln(out, "  }")
+	}
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+// writeDotNodes writes the nodes drawn in the inlined file parent, or at
+// the top level of the graph when parent is nil, and a nested cluster for
+// each file inlined there.
+func writeDotNodes(out *bufio.Writer, i int, g *Graph, parent *Inclusion, indent string) {
+	for _, n := range g.Nodes {
+		if g.cluster(n) == parent {
+			fmt.Fprintf(out, "%s%s [id=%s, %s];\n", indent, dotID(g, n), dotQuote(nodeKey(i, n)), dotNodeAttrs(n)+dotTooltip(n.Loc))
+		}
+	}
+	for _, inc := range g.Inclusions {
+		if g.own(inc.Parent) != parent {
+			continue
+		}
+		fmt.Fprintf(out, "%ssubgraph cluster_%d_%d {\n", indent, i, inc.ID)
+		fmt.Fprintf(out, "%s  id=%s;\n", indent, dotQuote(inclusionKey(i, inc)))
+		fmt.Fprintf(out, "%s  label=%s;\n", indent, dotQuote(inc.Name()))
+		fmt.Fprintf(out, "%s  style=dashed;\n", indent)
+		writeDotNodes(out, i, g, inc, indent+"  ")
+		fmt.Fprintf(out, "%s}\n", indent)
+	}
+}
+
+func dotID(g *Graph, n *Node) string {
+	return dotQuote(fmt.Sprintf("%s:n%d", g.Name, n.ID))
+}
+
+// dotNodeAttrs picks the flowchart shape of a node: ellipses for start and
+// end, diamonds for decisions, boxes for statements and parallelograms for
+// output.
+func dotNodeAttrs(n *Node) string {
+	label := dotQuote(n.Label)
+	switch n.Kind {
+	case NodeStart, NodeEnd:
+		return "shape=ellipse, label=" + label
+	case NodeDecision, NodeLoop:
+		return "shape=diamond, label=" + label
+	case NodeBlock:
+		lines := make([]string, 0, len(n.Stmts))
+		for _, s := range n.Stmts {
+			for _, line := range strings.Split(s.Text, "\n") {
+				lines = append(lines, dotEscape(line)+`\l`)
+			}
+		}
+		shape := "box"
+		if n.Output() {
+			shape = "parallelogram"
+		}
+		return fmt.Sprintf(`shape=%s, label="%s"`, shape, strings.Join(lines, ""))
+	case NodeMerge:
+		if n.Label == "" {
+			return `shape=point, label=""`
+		}
+		return "shape=box, style=rounded, label=" + label
+	case NodeReturn:
+		return "shape=ellipse, peripheries=2, label=" + label
+	case NodeExit:
+		return "shape=octagon, label=" + label
+	case NodeThrow:
+		return "shape=ellipse, color=red, label=" + label
+	case NodeCatch:
+		return "shape=box, style=dashed, label=" + label
+	case NodeLabel:
+		return "shape=cds, label=" + label
+	case NodeUnparseable:
+		return "shape=note, color=red, style=filled, fillcolor=mistyrose, label=" + label
+	case NodeRecursion:
+		return `shape=box, style="rounded,dashed", label=` + label
+	}
+	return "label=" + label
+}
+
+func dotEdgeAttrs(e *Edge) string {
+	var attrs []string
+	if e.Label != "" {
+		attrs = append(attrs, "label="+dotQuote(e.Label))
+	}
+	switch e.Kind {
+	case EdgeBack:
+		attrs = append(attrs, "style=dashed")
+	case EdgeFallthrough:
+		attrs = append(attrs, "color=orange", "penwidth=2")
+	case EdgeException:
+		attrs = append(attrs, "color=red", "style=dashed")
+	case EdgeGoto:
+		attrs = append(attrs, "style=dotted")
+	}
+	if e.Loc != nil {
+		attrs = append(attrs, "tooltip="+dotQuote(e.Loc.String()))
+	}
+	return strings.Join(attrs, ", ")
+}
+
+// dotTooltip returns the tooltip attribute showing loc, to append to the
+// attributes of a node.
+func dotTooltip(loc *Location) string {
+	if loc == nil {
+		return ""
+	}
+	return ", tooltip=" + dotQuote(loc.String())
+}
+
+func dotQuote(s string) string {
+	return `"` + dotEscape(s) + `"`
+}
+
+func dotEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
@@ -0,0 +1,138 @@
+package visualizephp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	phperrors "github.com/VKCOM/php-parser/pkg/errors"
+	"github.com/VKCOM/php-parser/pkg/position"
+)
+
+// ParseError is a syntax error in a file. The parser skips what it
+// cannot read and goes on, so a file with errors still has a tree.
+type ParseError struct {
+	Msg    string
+	Line   int
+	Column int
+	// Frame is the source around the error with the column marked.
+	Frame string
+	Pos   *position.Position
+}
+
+func newParseError(src []byte, e *phperrors.Error) *ParseError {
+	pe := &ParseError{Msg: e.Msg, Pos: e.Pos}
+	if e.Pos == nil || e.Pos.StartPos < 0 || e.Pos.StartPos > len(src) {
+		return pe
+	}
+	lineStart := bytes.LastIndexByte(src[:e.Pos.StartPos], '\n') + 1
+	pe.Line = e.Pos.StartLine
+	pe.Column = e.Pos.StartPos - lineStart + 1
+	pe.Frame = codeFrame(src, pe.Line, src[lineStart:e.Pos.StartPos])
+	return pe
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+// ParseErrors are the syntax errors of a file in source order.
+type ParseErrors []*ParseError
+
+func (l ParseErrors) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// codeFrame returns the line of src with the error and the lines around
+// it, numbered, with a caret under the column. before is the text of the
+// line up to the error.
+func codeFrame(src []byte, line int, before []byte) string {
+	lines := strings.Split(string(src), "\n")
+	width := len(fmt.Sprint(line + 1))
+	var sb strings.Builder
+	for l := line - 1; l <= line+1; l++ {
+		if l < 1 || l > len(lines) {
+			continue
+		}
+		marker := " "
+		if l == line {
+			marker = ">"
+		}
+		fmt.Fprintf(&sb, "%s %*d | %s\n", marker, width, l, strings.TrimRight(lines[l-1], "\r"))
+		if l == line {
+			// keep the tabs so the caret lines up
+			indent := strings.Map(func(r rune) rune {
+				if r == '\t' {
+					return r
+				}
+				return ' '
+			}, string(before))
+			fmt.Fprintf(&sb, "  %*s | %s^\n", width, "", indent)
+		}
+	}
+	return sb.String()
+}
+
+// unparsed hands out each parse error once, to the innermost statement
+// holding it.
+type unparsed struct {
+	errs  ParseErrors
+	shown []bool
+}
+
+func newUnparsed(errs ParseErrors) *unparsed {
+	return &unparsed{errs: errs, shown: make([]bool, len(errs))}
+}
+
+// take returns the errors within pos not taken yet, every one left when
+// pos is nil.
+func (u *unparsed) take(pos *position.Position) []*ParseError {
+	return u.takeIf(func(e *ParseError) bool {
+		return pos == nil || within(e, pos)
+	})
+}
+
+// takeIf returns the errors not taken yet that match.
+func (u *unparsed) takeIf(match func(e *ParseError) bool) []*ParseError {
+	if u == nil {
+		return nil
+	}
+	var errs []*ParseError
+	for i, e := range u.errs {
+		if !u.shown[i] && match(e) {
+			u.shown[i] = true
+			errs = append(errs, e)
+		}
+	}
+	return errs
+}
+
+func within(e *ParseError, pos *position.Position) bool {
+	return e.Pos != nil && pos != nil && e.Pos.StartPos >= pos.StartPos && e.Pos.StartPos <= pos.EndPos
+}
+
+// unparseableText returns the label of the node standing for the code
+// around e: the message and the line it is on.
+func unparseableText(src []byte, e *ParseError) string {
+	label := "unparseable: " + e.Msg
+	if e.Line == 0 {
+		return label
+	}
+	lines := strings.Split(string(src), "\n")
+	if e.Line > len(lines) {
+		return label
+	}
+	if line := strings.Join(strings.Fields(lines[e.Line-1]), " "); line != "" {
+		label += "\n" + line
+	}
+	return label
+}
@@ -0,0 +1,228 @@
+package visualizephp
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/VKCOM/php-parser/pkg/ast"
+	"github.com/VKCOM/php-parser/pkg/visitor"
+	"github.com/VKCOM/php-parser/pkg/visitor/traverser"
+)
+
+// callExpander expands the calls to the functions declared in the files
+// being read into the flow of the caller.
+type callExpander struct {
+	// depth is how many calls deep to expand.
+	depth int
+	// functions are the declared functions by lower case name.
+	functions map[string]declaredFunction
+	// active are the functions being expanded, outermost first.
+	active []*ast.StmtFunction
+}
+
+// declaredFunction is a function and the declarations of its file, to
+// resolve the names in its body.
+type declaredFunction struct {
+	fn    *ast.StmtFunction
+	decls *fileDecls
+}
+
+// add indexes the functions of a file, the first one declared with a
+// name winning.
+func (e *callExpander) add(d *fileDecls) {
+	for _, fn := range d.functions {
+		key := strings.ToLower(d.qualify(nameString(fn.Name), fn.Position))
+		if _, ok := e.functions[key]; !ok {
+			e.functions[key] = declaredFunction{fn, d}
+		}
+	}
+}
+
+// lookup returns the function call, made in the file of d, calls.
+func (e *callExpander) lookup(d *fileDecls, call *ast.ExprFunctionCall) (declaredFunction, bool) {
+	name := nameString(call.Function)
+	if name == "" {
+		return declaredFunction{}, false
+	}
+	fq, global := d.resolve(nameFunction, name, call.Position)
+	if f, ok := e.functions[strings.ToLower(fq)]; ok || global == "" {
+		return f, ok
+	}
+	f, ok := e.functions[strings.ToLower(global)]
+	return f, ok
+}
+
+// recursive tells whether fn is being expanded already.
+func (e *callExpander) recursive(fn *ast.StmtFunction) bool {
+	for _, active := range e.active {
+		if active == fn {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandCalls makes the reader draw the body of the functions the file
+// declares where they are called, depth calls deep, with the arguments
+// assigned to the parameters first. A recursive call is not expanded
+// again but marked.
+func (a *AstReader) ExpandCalls(depth int) {
+	a.expander = &callExpander{depth: depth, functions: make(map[string]declaredFunction)}
+}
+
+// expandCalls expands the calls of n to the functions of the files read,
+// in the order they are made. The calls in closures, which do not run
+// here, and in match expressions, whose arms are expanded on their own,
+// are left alone.
+func (a *AstReader) expandCalls(n ast.Vertex) {
+	e := a.expander
+	if e == nil || a.decls == nil {
+		return
+	}
+	finder := &callFinder{}
+	traverser.NewTraverser(finder).Traverse(n)
+	for _, call := range finder.made() {
+		f, ok := e.lookup(a.decls, call)
+		if !ok {
+			continue
+		}
+		label := a.flow.text(call)
+		if e.recursive(f.fn) {
+			a.flow.Recursion(label, call.Position)
+			continue
+		}
+		if len(e.active) >= e.depth {
+			continue
+		}
+
+		file := f.decls.file
+		saved := a.flow.BeginCall(label, file.Path, file.Src, bindings(a.flow.src, call, file.Src, f.fn))
+		child := a.newChild()
+		child.decls = f.decls
+		child.unparsed = nil
+		e.active = append(e.active, f.fn)
+		child.visitStmts(f.fn.Stmts)
+		e.active = e.active[:len(e.active)-1]
+		a.flow.EndCall(saved)
+	}
+}
+
+// bindings returns the assignments of the arguments of call, in src, to
+// the parameters of fn, in fnSrc. Default values stand in for the
+// arguments not given.
+func bindings(src []byte, call *ast.ExprFunctionCall, fnSrc []byte, fn *ast.StmtFunction) []Statement {
+	var positional []*ast.Argument
+	named := make(map[string]*ast.Argument)
+	var spread *ast.Argument
+	for _, arg := range call.Args {
+		arg, ok := arg.(*ast.Argument)
+		switch {
+		case !ok:
+		case arg.VariadicTkn != nil:
+			spread = arg
+		case arg.Name != nil:
+			named[nameString(arg.Name)] = arg
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	var stmts []Statement
+	for i, p := range fn.Params {
+		p, ok := p.(*ast.Parameter)
+		if !ok {
+			continue
+		}
+		name := variableName(p.Var)
+		var value string
+		switch arg, isNamed := named[strings.TrimPrefix(name, "$")]; {
+		case p.VariadicTkn != nil:
+			var rest []string
+			for j := i; j < len(positional); j++ {
+				rest = append(rest, printPHP(src, positional[j].Expr))
+			}
+			if spread != nil {
+				rest = append(rest, printPHP(src, spread))
+			}
+			value = "[" + strings.Join(rest, ", ") + "]"
+		case i < len(positional):
+			value = printPHP(src, positional[i].Expr)
+		case isNamed:
+			value = printPHP(src, arg.Expr)
+		case spread != nil:
+			value = printPHP(src, spread.Expr) + "[" + strconv.Itoa(i-len(positional)) + "]"
+		case p.DefaultValue != nil:
+			value = printPHP(fnSrc, p.DefaultValue)
+		default:
+			// too few arguments, PHP throws an ArgumentCountError
+			continue
+		}
+		op := " = "
+		if p.AmpersandTkn != nil {
+			op = " = &"
+		}
+		stmts = append(stmts, Statement{Text: name + op + value + ";"})
+	}
+	return stmts
+}
+
+// callFinder collects the function calls of a subtree and what holds
+// calls not made with the others.
+type callFinder struct {
+	visitor.Null
+	calls []*ast.ExprFunctionCall
+	// apart are the closures, the bodies of anonymous classes and the
+	// match expressions.
+	apart []ast.Vertex
+}
+
+func (f *callFinder) ExprFunctionCall(n *ast.ExprFunctionCall) {
+	// f(...) makes a closure of f
+	if n.EllipsisTkn == nil {
+		f.calls = append(f.calls, n)
+	}
+}
+
+func (f *callFinder) ExprClosure(n *ast.ExprClosure) {
+	f.apart = append(f.apart, n)
+}
+
+func (f *callFinder) ExprArrowFunction(n *ast.ExprArrowFunction) {
+	f.apart = append(f.apart, n)
+}
+
+func (f *callFinder) StmtClass(n *ast.StmtClass) {
+	// the methods of an anonymous class
+	f.apart = append(f.apart, n.Stmts...)
+}
+
+func (f *callFinder) ExprMatch(n *ast.ExprMatch) {
+	f.apart = append(f.apart, n)
+}
+
+func (f *callFinder) StmtFunction(n *ast.StmtFunction) {
+	f.apart = append(f.apart, n)
+}
+
+// made returns the calls made, in the order PHP makes them: the arguments
+// of a call before the call, so by where they end.
+func (f *callFinder) made() []*ast.ExprFunctionCall {
+	var calls []*ast.ExprFunctionCall
+	for _, call := range f.calls {
+		inside := false
+		for _, n := range f.apart {
+			if contains(n.GetPosition(), call.Position) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			calls = append(calls, call)
+		}
+	}
+	sort.SliceStable(calls, func(i, j int) bool {
+		return calls[i].Position.EndPos < calls[j].Position.EndPos
+	})
+	return calls
+}
@@ -0,0 +1,1268 @@
+package visualizephp
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/VKCOM/php-parser/pkg/ast"
+	"github.com/VKCOM/php-parser/pkg/position"
+)
+
+// NodeKind says what a node in the flowchart stands for.
+type NodeKind int
+
+const (
+	NodeStart NodeKind = iota
+	NodeEnd
+	NodeBlock
+	NodeDecision
+	NodeMerge
+	NodeLoop
+	// NodeThrow is where exceptions nothing in the graph catches leave it.
+	NodeThrow
+	NodeCatch
+	// NodeReturn ends a path at a return statement.
+	NodeReturn
+	// NodeExit ends a path at exit() or die(), stopping the script.
+	NodeExit
+	// NodeLabel is the target of goto statements.
+	NodeLabel
+	// NodeUnparseable stands for code the parser skipped over.
+	NodeUnparseable
+	// NodeRecursion is a recursive call that is not expanded again.
+	NodeRecursion
+)
+
+func (k NodeKind) String() string {
+	switch k {
+	case NodeStart:
+		return "start"
+	case NodeEnd:
+		return "end"
+	case NodeBlock:
+		return "block"
+	case NodeDecision:
+		return "decision"
+	case NodeMerge:
+		return "merge"
+	case NodeLoop:
+		return "loop"
+	case NodeThrow:
+		return "throw"
+	case NodeCatch:
+		return "catch"
+	case NodeReturn:
+		return "return"
+	case NodeExit:
+		return "exit"
+	case NodeLabel:
+		return "label"
+	case NodeUnparseable:
+		return "unparseable"
+	case NodeRecursion:
+		return "recursion"
+	}
+	return fmt.Sprintf("NodeKind(%d)", int(k))
+}
+
+// EdgeKind tells ordinary edges apart from the ones renderers draw
+// differently.
+type EdgeKind int
+
+const (
+	EdgeNormal EdgeKind = iota
+	// EdgeBack closes a loop, going from the end of the body back to the
+	// loop header.
+	EdgeBack
+	// EdgeFallthrough goes from the end of a switch case that has no break
+	// into the body of the next case.
+	EdgeFallthrough
+	// EdgeException is taken when a statement throws, leading to a catch
+	// clause, a finally block or the end of the graph.
+	EdgeException
+	// EdgeGoto jumps from a goto statement to its label.
+	EdgeGoto
+)
+
+func (k EdgeKind) String() string {
+	switch k {
+	case EdgeNormal:
+		return "normal"
+	case EdgeBack:
+		return "back"
+	case EdgeFallthrough:
+		return "fallthrough"
+	case EdgeException:
+		return "exception"
+	case EdgeGoto:
+		return "goto"
+	}
+	return fmt.Sprintf("EdgeKind(%d)", int(k))
+}
+
+// Statement is a single line of a basic block. Output statements (echo,
+// print, inline HTML) are kept in blocks of their own.
+type Statement struct {
+	Text   string
+	Output bool
+	Loc    *Location
+}
+
+// Location is the stretch of a file a node, statement or edge comes from.
+// Lines and columns count from 1, columns in bytes, and EndColumn is the
+// column of the last character.
+type Location struct {
+	// File is the path of the file relative to the directory of the file
+	// being read, its name for that file.
+	File        string `json:"file,omitempty"`
+	StartLine   int    `json:"startLine"`
+	StartColumn int    `json:"startColumn"`
+	EndLine     int    `json:"endLine"`
+	EndColumn   int    `json:"endColumn"`
+}
+
+// String returns the file and line of l, such as test.php:12, or its
+// lines when it spans several, such as test.php:12-14.
+func (l *Location) String() string {
+	s := fmt.Sprintf("%s:%d", l.File, l.StartLine)
+	if l.EndLine > l.StartLine {
+		s += fmt.Sprintf("-%d", l.EndLine)
+	}
+	return s
+}
+
+// Node is a basic block, a decision, a loop header or one of the
+// structural nodes (start, end, merge) of a Graph.
+type Node struct {
+	ID    int
+	Kind  NodeKind
+	Label string
+	Stmts []Statement
+	// Loc is where n is in the source, nil for the structural nodes. The
+	// location of a block runs from its first statement to its last.
+	Loc *Location
+	// In is the inlined file or expanded call the node comes from, nil
+	// for the file the graph belongs to.
+	In *Inclusion
+}
+
+// Output tells whether n is a block of output statements.
+func (n *Node) Output() bool {
+	return n.Kind == NodeBlock && len(n.Stmts) != 0 && n.Stmts[0].Output
+}
+
+// Edge connects two nodes. Edges leaving a decision carry "true" or
+// "false" as their label, the ones leaving a foreach header "next" or
+// "done" and the ones leaving a match the conditions of the arm they lead
+// to.
+type Edge struct {
+	From  *Node
+	To    *Node
+	Label string
+	Kind  EdgeKind
+	// Loc is the code control leaves From by: the node, or the last
+	// statement of a block. It is nil when From has no location.
+	Loc *Location
+}
+
+// Graph is the control flow of a single statement list: the top level of
+// a file or the body of a function.
+type Graph struct {
+	Name  string
+	Start *Node
+	End   *Node
+	// Throws is where uncaught exceptions leave the graph, nil when no
+	// throw escapes.
+	Throws *Node
+	Nodes  []*Node
+	Edges  []*Edge
+	// Inclusions are the files inlined in the graph where they are
+	// included and the calls expanded, in the order they were met.
+	Inclusions []*Inclusion
+	// Params and Returns are the parameters and return type of the
+	// function the graph is the body of.
+	Params  []*Param
+	Returns string
+}
+
+// Inclusion is a file whose top-level statements were inlined where an
+// include or require statement includes it, or a function whose body was
+// expanded where it is called.
+type Inclusion struct {
+	// ID is the index of the inclusion in Graph.Inclusions.
+	ID int
+	// Path is the file the statements are in, "" for the file the graph
+	// belongs to.
+	Path string
+	Src  []byte
+	// Call is the call expanded, "" for an included file.
+	Call string
+	// Parent is the inclusion holding the include statement or call, nil
+	// when it is in the file the graph belongs to.
+	Parent *Inclusion
+}
+
+// cluster returns the inclusion n is drawn in, nil when it is drawn at
+// the top level of the graph.
+func (g *Graph) cluster(n *Node) *Inclusion {
+	return g.own(n.In)
+}
+
+// own returns inc when it was inlined in the graph, nil otherwise.
+func (g *Graph) own(inc *Inclusion) *Inclusion {
+	if inc != nil && inc.ID < len(g.Inclusions) && g.Inclusions[inc.ID] == inc {
+		return inc
+	}
+	return nil
+}
+
+// Name is the name of the inlined file or the call, for cluster titles.
+func (inc *Inclusion) Name() string {
+	if inc.Call != "" {
+		return inc.Call
+	}
+	return filepath.Base(inc.Path)
+}
+
+// inclusionKey identifies inclusion inc of the graph at index graph of a
+// Flow, like nodeKey.
+func inclusionKey(graph int, inc *Inclusion) string {
+	return fmt.Sprintf("g%di%d", graph, inc.ID)
+}
+
+// Flow holds every graph found in a file, the top level first.
+type Flow struct {
+	Graphs []*Graph
+
+	// source is the file BuildFlow read, nil for flows built otherwise.
+	source *flowSource
+}
+
+// Graph returns the graph with the given name, "{main}" for the top level
+// of the file, or nil if there is none.
+func (f *Flow) Graph(name string) *Graph {
+	name = strings.TrimPrefix(name, `\`)
+	for _, g := range f.Graphs {
+		// PHP function names are case-insensitive
+		if strings.EqualFold(g.Name, name) {
+			return g
+		}
+	}
+	return nil
+}
+
+func (f *Flow) String() string {
+	var sb strings.Builder
+	for _, g := range f.Graphs {
+		fmt.Fprintf(&sb, "graph %s\n", g.Name)
+		for _, n := range g.Nodes {
+			fmt.Fprintf(&sb, "  n%d %s", n.ID, n.Kind)
+			if n.Label != "" {
+				fmt.Fprintf(&sb, " %q", n.Label)
+			}
+			sb.WriteString("\n")
+			for _, s := range n.Stmts {
+				fmt.Fprintf(&sb, "    %s\n", s.Text)
+			}
+		}
+		for _, e := range g.Edges {
+			fmt.Fprintf(&sb, "  n%d -> n%d", e.From.ID, e.To.ID)
+			if e.Label != "" {
+				fmt.Fprintf(&sb, " [%s]", e.Label)
+			}
+			if e.Kind != EdgeNormal {
+				fmt.Fprintf(&sb, " (%s)", e.Kind)
+			}
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// nodeKey identifies node n of the graph at index graph of a Flow, the same
+// way in every output format.
+func nodeKey(graph int, n *Node) string {
+	return fmt.Sprintf("g%dn%d", graph, n.ID)
+}
+
+// Span returns the lines of the source n stands for, zero when it has
+// none.
+func (n *Node) Span() (start, end int) {
+	if n.Loc == nil {
+		return 0, 0
+	}
+	return n.Loc.StartLine, n.Loc.EndLine
+}
+
+// exit is a dangling edge waiting for the next node on its path.
+type exit struct {
+	node  *Node
+	label string
+	kind  EdgeKind
+}
+
+// loop collects the break and continue statements of a loop until the
+// loop is finished and knows where they lead.
+type loop struct {
+	breaks    []exit
+	continues []exit
+}
+
+// switchCase tracks a switch statement while its cases are added.
+type switchCase struct {
+	subject string
+	// tests is the false exit of the last case condition, the path taken
+	// when none of the cases seen so far matched.
+	tests []exit
+	// fall are the exits of the previous case body, falling through into
+	// the next one.
+	fall        []exit
+	defaultCase *Node
+}
+
+// tryPhase is the part of a try statement being built.
+type tryPhase int
+
+const (
+	tryBody tryPhase = iota
+	tryCatch
+	tryFinally
+)
+
+// tryBlock tracks a try statement while it is built.
+type tryBlock struct {
+	phase   tryPhase
+	catches []*catchClause
+	// next is the index of the catch clause built next.
+	next       int
+	hasFinally bool
+	// ends are the exits of the try body and catch clauses completing
+	// normally.
+	ends []exit
+	// finally are the exceptions that run the finally block before
+	// leaving the try statement.
+	finally []exit
+	// returns are the return statements that run the finally block
+	// before leaving the function.
+	returns []exit
+	// completes tells whether the finally block is entered by a path
+	// completing normally, which goes on after the try statement.
+	completes bool
+	// calls is the number of calls being expanded the try statement is
+	// in, the return statements of the function it belongs to see it.
+	calls int
+}
+
+// catchClause collects the exceptional exits a catch clause is entered by.
+type catchClause struct {
+	types   []string
+	entries []exit
+}
+
+// catches tells whether the clause may catch an exception of class typ and
+// whether it is sure to. An empty typ is an exception of unknown class, as
+// thrown by any call. The class hierarchy is not known, so a clause is
+// only sure to catch Throwable and the class it names, compared without
+// namespace, and may catch any other as a subclass.
+func (c *catchClause) catches(typ string) (match, certain bool) {
+	for _, t := range c.types {
+		t = baseName(t)
+		if strings.EqualFold(t, "Throwable") || typ != "" && strings.EqualFold(t, baseName(typ)) {
+			return true, true
+		}
+	}
+	return len(c.types) != 0, false
+}
+
+func baseName(name string) string {
+	return name[strings.LastIndex(name, "\\")+1:]
+}
+
+// FlowBuilder collects the control flow graphs while an AstReader walks
+// the tree. AstReader handlers call into it as they meet statements.
+type FlowBuilder struct {
+	src []byte
+	// file is the name of the file being read and dir its directory, the
+	// files of the locations are relative to.
+	file, dir string
+	flow      *Flow
+
+	graph *Graph
+	// open are the exits the next node gets connected to. It is empty
+	// when the code that follows is unreachable.
+	open []exit
+	// block is the basic block statements are appended to, nil when the
+	// next statement has to start a new one.
+	block *Node
+	// chain collects the exits of the branches of the if chain being
+	// built, so StmtElseIf and StmtElse can add theirs.
+	chain []exit
+	// loops are the enclosing loops, innermost last. A switch counts as
+	// a loop for break and continue.
+	loops    []*loop
+	switches []*switchCase
+	// tries are the enclosing try statements, innermost last.
+	tries []*tryBlock
+	// labels are the goto labels of the graph seen so far, gotos the
+	// jumps to labels further down.
+	labels map[string]*Node
+	gotos  map[string][]exit
+	// inclusion is the file being inlined, nil for the file being read.
+	inclusion *Inclusion
+	// included are the files included on every path reaching a node,
+	// for include_once and require_once.
+	included map[*Node]fileSet
+	// returns collect the exits of the return statements of each call
+	// being expanded, innermost last.
+	returns [][]exit
+	// leaving are the ends of the finally blocks run by return
+	// statements, which leave through the end node.
+	leaving []exit
+	// labelFormat shortens the labels of nodes and edges.
+	labelFormat LabelFormat
+}
+
+// LabelFormat says how long the lines of node and edge labels may get.
+type LabelFormat struct {
+	// MaxLength is the number of characters a line is cut at, its end
+	// replaced by an ellipsis. 0 leaves lines whole.
+	MaxLength int
+	// Width is the number of characters lines are wrapped at, between
+	// words. Words longer than that get a line of their own. 0 leaves
+	// lines unwrapped.
+	Width int
+}
+
+// format cuts and then wraps each line of s. Wrapped lines after the
+// first are indented.
+func (f LabelFormat) format(s string) string {
+	if f.MaxLength <= 0 && f.Width <= 0 {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if r := []rune(line); f.MaxLength > 0 && len(r) > f.MaxLength {
+			line = strings.TrimRight(string(r[:f.MaxLength-1]), " ") + "…"
+		}
+		lines[i] = f.wrap(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (f LabelFormat) wrap(line string) string {
+	if f.Width <= 0 || utf8.RuneCountInString(line) <= f.Width {
+		return line
+	}
+	const indent = "  "
+	var wrapped []string
+	current := ""
+	for _, word := range strings.Fields(line) {
+		switch {
+		case current == "":
+			current = word
+		case utf8.RuneCountInString(current)+1+utf8.RuneCountInString(word) > f.Width:
+			wrapped = append(wrapped, current)
+			current = indent + word
+		default:
+			current += " " + word
+		}
+	}
+	return strings.Join(append(wrapped, current), "\n")
+}
+
+// fileSet is a set of file paths. Sets are shared between nodes and never
+// changed once built.
+type fileSet map[string]bool
+
+func NewFlowBuilder(src []byte) *FlowBuilder {
+	return &FlowBuilder{
+		src:      src,
+		flow:     &Flow{},
+		included: make(map[*Node]fileSet),
+	}
+}
+
+func (b *FlowBuilder) Flow() *Flow {
+	return b.flow
+}
+
+// builderState is what BeginGraph saves so EndGraph can resume the
+// enclosing graph.
+type builderState struct {
+	graph    *Graph
+	open     []exit
+	block    *Node
+	chain    []exit
+	loops    []*loop
+	switches []*switchCase
+	tries    []*tryBlock
+	labels   map[string]*Node
+	gotos    map[string][]exit
+	leaving  []exit
+}
+
+// BeginGraph starts a new graph, e.g. for a function body, and returns the
+// state of the graph being built so far.
+func (b *FlowBuilder) BeginGraph(name string, pos *position.Position) builderState {
+	saved := builderState{b.graph, b.open, b.block, b.chain, b.loops, b.switches, b.tries, b.labels, b.gotos, b.leaving}
+
+	g := &Graph{Name: name}
+	b.flow.Graphs = append(b.flow.Graphs, g)
+	b.graph = g
+	b.open = nil
+	b.block = nil
+	b.chain = nil
+	b.loops = nil
+	b.switches = nil
+	b.tries = nil
+	b.labels = make(map[string]*Node)
+	b.gotos = make(map[string][]exit)
+	b.leaving = nil
+
+	g.Start = b.enter(NodeStart, name, pos)
+	return saved
+}
+
+// Signature sets the parameters and return type of the function the
+// graph being built is the body of.
+func (b *FlowBuilder) Signature(params []*Param, returns string) {
+	b.graph.Params, b.graph.Returns = params, returns
+}
+
+// EndGraph connects whatever is still open to the end node and resumes
+// the graph saved by BeginGraph.
+func (b *FlowBuilder) EndGraph(saved builderState) {
+	b.undefinedLabels()
+	b.open = append(b.open, b.leaving...)
+	b.graph.End = b.enter(NodeEnd, "end", nil)
+
+	b.graph = saved.graph
+	b.open = saved.open
+	b.block = saved.block
+	b.chain = saved.chain
+	b.loops = saved.loops
+	b.switches = saved.switches
+	b.tries = saved.tries
+	b.labels = saved.labels
+	b.gotos = saved.gotos
+	b.leaving = saved.leaving
+}
+
+func (b *FlowBuilder) newNode(kind NodeKind, label string, pos *position.Position) *Node {
+	if kind != NodeUnparseable {
+		// unparseable nodes show the source lines as they are
+		label = b.labelFormat.format(label)
+	}
+	n := &Node{
+		ID:    len(b.graph.Nodes),
+		Kind:  kind,
+		Label: label,
+		Loc:   b.locate(pos),
+		In:    b.inclusion,
+	}
+	b.graph.Nodes = append(b.graph.Nodes, n)
+	b.included[n] = b.includedHere()
+	return n
+}
+
+func (b *FlowBuilder) link(from, to *Node, label string, kind EdgeKind) {
+	if kind == EdgeException {
+		// a block with several calls throws to the same catch only
+		// once, labelled with the class when one of them is known
+		label = b.labelFormat.format(label)
+		for _, e := range b.graph.Edges {
+			if e.From == from && e.To == to && e.Kind == kind {
+				if e.Label == "exception" {
+					e.Label = label
+				}
+				return
+			}
+		}
+	}
+	label = b.labelFormat.format(label)
+	loc := from.Loc
+	if len(from.Stmts) != 0 {
+		loc = from.Stmts[len(from.Stmts)-1].Loc
+	}
+	b.graph.Edges = append(b.graph.Edges, &Edge{From: from, To: to, Label: label, Kind: kind, Loc: loc})
+}
+
+// locate returns the location of pos in the file being read or inlined,
+// nil for a nil pos.
+func (b *FlowBuilder) locate(pos *position.Position) *Location {
+	if pos == nil {
+		return nil
+	}
+	file := b.file
+	if b.inclusion != nil && b.inclusion.Path != "" {
+		file = b.inclusion.Path
+		if rel, err := filepath.Rel(b.dir, file); err == nil && b.dir != "" {
+			file = rel
+		}
+	}
+	return &Location{
+		File:        file,
+		StartLine:   pos.StartLine,
+		StartColumn: column(b.src, pos.StartPos),
+		EndLine:     pos.EndLine,
+		EndColumn:   column(b.src, pos.EndPos-1),
+	}
+}
+
+// column returns the column of the byte at offset in src, 0 when offset
+// is out of src.
+func column(src []byte, offset int) int {
+	if offset < 0 || offset > len(src) {
+		return 0
+	}
+	return offset - bytes.LastIndexByte(src[:offset], '\n')
+}
+
+// enter adds a node, connects every open exit to it and makes it the only
+// open exit.
+func (b *FlowBuilder) enter(kind NodeKind, label string, pos *position.Position) *Node {
+	n := b.newNode(kind, label, pos)
+	for _, e := range b.open {
+		b.link(e.node, n, e.label, e.kind)
+	}
+	b.open = []exit{{node: n}}
+	b.block = nil
+	return n
+}
+
+// Statement appends a straight-line statement to the current basic block,
+// starting a new one when needed.
+func (b *FlowBuilder) Statement(n ast.Vertex) {
+	output := isOutput(n)
+	if b.block != nil && b.block.Output() != output {
+		b.block = nil
+	}
+	if b.block == nil {
+		b.block = b.enter(NodeBlock, "", n.GetPosition())
+	}
+	loc := b.locate(n.GetPosition())
+	b.block.Stmts = append(b.block.Stmts, Statement{
+		Text:   b.labelFormat.format(b.text(n)),
+		Output: output,
+		Loc:    loc,
+	})
+	if b.block.Loc != nil && loc != nil {
+		b.block.Loc.EndLine, b.block.Loc.EndColumn = loc.EndLine, loc.EndColumn
+	}
+}
+
+// isOutput tells whether n is a statement writing output.
+func isOutput(n ast.Vertex) bool {
+	switch n := n.(type) {
+	case *ast.StmtEcho, *ast.StmtInlineHtml:
+		return true
+	case *ast.StmtExpression:
+		_, ok := n.Expr.(*ast.ExprPrint)
+		return ok
+	}
+	return false
+}
+
+// Decision adds a decision node for cond. The caller picks which of its
+// exits to follow with Follow.
+func (b *FlowBuilder) Decision(cond ast.Vertex) *Node {
+	return b.enter(NodeDecision, b.text(cond), cond.GetPosition())
+}
+
+// Follow continues building from a single labelled exit of n.
+func (b *FlowBuilder) Follow(n *Node, label string) {
+	b.open = []exit{{node: n, label: label}}
+	b.block = nil
+}
+
+// BeginChain starts collecting branch exits for an if chain and returns
+// the exits of any enclosing chain.
+func (b *FlowBuilder) BeginChain() []exit {
+	saved := b.chain
+	b.chain = nil
+	return saved
+}
+
+// EndBranch records the open exits as the end of one branch of the chain.
+func (b *FlowBuilder) EndBranch() {
+	b.chain = append(b.chain, b.open...)
+	b.open = nil
+	b.block = nil
+}
+
+// EndChain joins the branches of the chain with a merge node, unless none
+// of them fall through.
+func (b *FlowBuilder) EndChain(saved []exit) {
+	b.open = append(b.chain, b.open...)
+	b.chain = saved
+	if len(b.open) == 0 {
+		b.block = nil
+		return
+	}
+	b.enter(NodeMerge, "", nil)
+}
+
+// Join adds a merge node for the open exits, giving a later back edge a
+// node to return to.
+func (b *FlowBuilder) Join() *Node {
+	return b.enter(NodeMerge, "", nil)
+}
+
+// LoopHeader adds the node deciding whether a loop runs another
+// iteration.
+func (b *FlowBuilder) LoopHeader(label string, pos *position.Position) *Node {
+	return b.enter(NodeLoop, label, pos)
+}
+
+// BeginLoop makes break and continue statements target a new innermost
+// loop.
+func (b *FlowBuilder) BeginLoop() {
+	b.loops = append(b.loops, &loop{})
+}
+
+// JoinContinues adds the exits of the continue statements aimed at the
+// innermost loop to the open exits, at the point where the loop goes on
+// with its next iteration.
+func (b *FlowBuilder) JoinContinues() {
+	l := b.loops[len(b.loops)-1]
+	b.open = append(b.open, l.continues...)
+	l.continues = nil
+	b.block = nil
+}
+
+// Repeat closes the body of a loop with back edges to header.
+func (b *FlowBuilder) Repeat(header *Node) {
+	for _, e := range b.open {
+		b.link(e.node, header, e.label, EdgeBack)
+	}
+	b.open = nil
+	b.block = nil
+}
+
+// EndLoop leaves the innermost loop, its break statements joining the open
+// exits.
+func (b *FlowBuilder) EndLoop() {
+	l := b.loops[len(b.loops)-1]
+	b.loops = b.loops[:len(b.loops)-1]
+	b.open = append(b.open, l.breaks...)
+	b.block = nil
+}
+
+// Break jumps out of the loop level loops up, "break 2;" leaving two
+// nested loops. Levels beyond the outermost loop target the outermost one.
+func (b *FlowBuilder) Break(level int) {
+	if l := b.enclosingLoop(level); l != nil {
+		l.breaks = append(l.breaks, b.open...)
+		b.open = nil
+		b.block = nil
+	}
+}
+
+// Continue jumps to the next iteration of the loop level loops up.
+func (b *FlowBuilder) Continue(level int) {
+	if l := b.enclosingLoop(level); l != nil {
+		l.continues = append(l.continues, b.open...)
+		b.open = nil
+		b.block = nil
+	}
+}
+
+func (b *FlowBuilder) enclosingLoop(level int) *loop {
+	if len(b.loops) == 0 {
+		return nil
+	}
+	i := len(b.loops) - level
+	if i < 0 {
+		i = 0
+	}
+	return b.loops[i]
+}
+
+// Terminal adds a node ending the path. It stays open so the exceptions
+// its expression throws can be added, until Unreachable is called.
+func (b *FlowBuilder) Terminal(kind NodeKind, label string, pos *position.Position) *Node {
+	return b.enter(kind, label, pos)
+}
+
+// Leave ends the path of a return statement. Return statements within
+// try statements with a finally block run it first, unlike exit, which
+// leaves without running it.
+func (b *FlowBuilder) Leave() {
+	b.leave(b.returning())
+	b.Unreachable()
+}
+
+// returning returns the open exits, labelled as the jumps of a return
+// statement to a finally block.
+func (b *FlowBuilder) returning() []exit {
+	exits := make([]exit, 0, len(b.open))
+	for _, e := range b.open {
+		exits = append(exits, exit{node: e.node, label: "return"})
+	}
+	return exits
+}
+
+// leave routes the exits of return statements to the innermost finally
+// block of the function they are in, and tells whether there is one.
+func (b *FlowBuilder) leave(exits []exit) bool {
+	for i := len(b.tries) - 1; i >= 0; i-- {
+		t := b.tries[i]
+		if t.calls != len(b.returns) {
+			// the try statement is around the call being expanded
+			return false
+		}
+		if t.hasFinally && t.phase != tryFinally {
+			t.returns = append(t.returns, exits...)
+			return true
+		}
+	}
+	return false
+}
+
+// Unreachable ends the open paths, code that follows is dead until the
+// next jump target.
+func (b *FlowBuilder) Unreachable() {
+	b.open = nil
+	b.block = nil
+}
+
+// Label adds the target of the goto statements to name, including the
+// ones seen before it.
+func (b *FlowBuilder) Label(name string, pos *position.Position) {
+	b.open = append(b.open, b.gotos[name]...)
+	delete(b.gotos, name)
+	b.labels[name] = b.enter(NodeLabel, name+":", pos)
+}
+
+// Unparseable adds a node for the code around a syntax error. The flow
+// goes on through it, what the parser skipped is unknown.
+func (b *FlowBuilder) Unparseable(e *ParseError) {
+	b.enter(NodeUnparseable, unparseableText(b.src, e), e.Pos)
+}
+
+// includeState is what BeginInclude saves so EndInclude can go back to
+// the including file.
+type includeState struct {
+	inclusion *Inclusion
+	src       []byte
+}
+
+// BeginInclude starts inlining the file at path, whose statements come
+// next, and returns the state of the including file. The file counts as
+// included on the open paths.
+func (b *FlowBuilder) BeginInclude(path string, src []byte) includeState {
+	saved := includeState{b.inclusion, b.src}
+	included := fileSet{path: true}
+	for _, e := range b.open {
+		for p := range b.included[e.node] {
+			included[p] = true
+		}
+		b.included[e.node] = included
+	}
+
+	b.inclusion = &Inclusion{
+		ID:     len(b.graph.Inclusions),
+		Path:   path,
+		Src:    src,
+		Parent: saved.inclusion,
+	}
+	b.graph.Inclusions = append(b.graph.Inclusions, b.inclusion)
+	b.src, b.block = src, nil
+	return saved
+}
+
+// EndInclude goes back to the including file saved by BeginInclude.
+func (b *FlowBuilder) EndInclude(saved includeState) {
+	b.inclusion, b.src = saved.inclusion, saved.src
+	b.block = nil
+}
+
+// callState is what BeginCall saves so EndCall can go back to the caller.
+type callState struct {
+	inclusion *Inclusion
+	src       []byte
+	loops     []*loop
+	switches  []*switchCase
+	labels    map[string]*Node
+	gotos     map[string][]exit
+}
+
+// BeginCall starts expanding call, a call to a function in the file at
+// path whose body comes next, with a block of bindings assigning the
+// arguments to the parameters. It returns the state of the caller.
+func (b *FlowBuilder) BeginCall(call, path string, src []byte, bindings []Statement) callState {
+	saved := callState{b.inclusion, b.src, b.loops, b.switches, b.labels, b.gotos}
+	b.inclusion = &Inclusion{
+		ID:     len(b.graph.Inclusions),
+		Path:   path,
+		Src:    src,
+		Call:   b.labelFormat.format(call),
+		Parent: saved.inclusion,
+	}
+	b.graph.Inclusions = append(b.graph.Inclusions, b.inclusion)
+	b.src, b.block = src, nil
+	// break, continue and goto do not leave a function
+	b.loops, b.switches = nil, nil
+	b.labels, b.gotos = make(map[string]*Node), make(map[string][]exit)
+	b.returns = append(b.returns, nil)
+
+	if len(bindings) != 0 {
+		block := b.enter(NodeBlock, "", nil)
+		for _, s := range bindings {
+			s.Text = b.labelFormat.format(s.Text)
+			block.Stmts = append(block.Stmts, s)
+		}
+		b.block = nil
+	}
+	return saved
+}
+
+// EndCall goes back to the caller saved by BeginCall, after the call
+// returns.
+func (b *FlowBuilder) EndCall(saved callState) {
+	b.undefinedLabels()
+	b.open = append(b.open, b.returns[len(b.returns)-1]...)
+	b.returns = b.returns[:len(b.returns)-1]
+	b.inclusion, b.src = saved.inclusion, saved.src
+	b.loops, b.switches = saved.loops, saved.switches
+	b.labels, b.gotos = saved.labels, saved.gotos
+	b.block = nil
+}
+
+// InCall tells whether a call is being expanded.
+func (b *FlowBuilder) InCall() bool {
+	return len(b.returns) != 0
+}
+
+// Return leaves the call being expanded.
+func (b *FlowBuilder) Return() {
+	if !b.leave(b.returning()) {
+		last := len(b.returns) - 1
+		b.returns[last] = append(b.returns[last], b.open...)
+	}
+	b.open = nil
+	b.block = nil
+}
+
+// Recursion adds a node for a recursive call that is not expanded again.
+func (b *FlowBuilder) Recursion(call string, pos *position.Position) {
+	b.enter(NodeRecursion, "recursive call "+call, pos)
+}
+
+// Included tells whether the file at path was included on every path
+// reaching the next node.
+func (b *FlowBuilder) Included(path string) bool {
+	return b.includedHere()[path]
+}
+
+// includedHere returns the files included on every open path.
+func (b *FlowBuilder) includedHere() fileSet {
+	if len(b.open) == 0 {
+		return nil
+	}
+	first := b.included[b.open[0].node]
+	here := fileSet{}
+	for p := range first {
+		here[p] = true
+		for _, e := range b.open[1:] {
+			if !b.included[e.node][p] {
+				delete(here, p)
+				break
+			}
+		}
+	}
+	if len(here) == len(first) {
+		return first
+	}
+	return here
+}
+
+// Goto jumps to the label name. The label may come later in the graph, so
+// the jump may enter a loop from the side: control flow built from gotos
+// does not have to be structured.
+func (b *FlowBuilder) Goto(name string) {
+	exits := make([]exit, 0, len(b.open))
+	for _, e := range b.open {
+		exits = append(exits, exit{node: e.node, label: "goto", kind: EdgeGoto})
+	}
+	if label, ok := b.labels[name]; ok {
+		for _, e := range exits {
+			b.link(e.node, label, e.label, e.kind)
+		}
+	} else {
+		b.gotos[name] = append(b.gotos[name], exits...)
+	}
+	b.Unreachable()
+}
+
+// undefinedLabels ends the gotos to labels the graph, or the function
+// being expanded, does not have, which PHP rejects, in a node per label.
+func (b *FlowBuilder) undefinedLabels() {
+	names := make([]string, 0, len(b.gotos))
+	for name := range b.gotos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		n := b.newNode(NodeExit, "undefined label "+name, nil)
+		for _, e := range b.gotos[name] {
+			b.link(e.node, n, e.label, e.kind)
+		}
+	}
+}
+
+// BeginSwitch starts a switch on subject. Cases are tested in order, the
+// path through the conditions starting from the open exits.
+func (b *FlowBuilder) BeginSwitch(subject string) {
+	b.BeginLoop()
+	b.switches = append(b.switches, &switchCase{
+		subject: subject,
+		tests:   b.open,
+	})
+	b.open = nil
+	b.block = nil
+}
+
+// Case adds the condition of a case. Its body is entered when the
+// condition holds or when the previous body falls through.
+func (b *FlowBuilder) Case(cond ast.Vertex) {
+	sw := b.switches[len(b.switches)-1]
+	b.open = sw.tests
+	decision := b.enter(NodeDecision, sw.subject+" == "+b.text(cond), cond.GetPosition())
+	sw.tests = []exit{{node: decision, label: "false"}}
+	b.open = append([]exit{{node: decision, label: "true"}}, sw.fall...)
+	b.block = nil
+}
+
+// Default adds the default case, entered when no case matches wherever it
+// appears in the switch.
+func (b *FlowBuilder) Default(pos *position.Position) {
+	sw := b.switches[len(b.switches)-1]
+	b.open = sw.fall
+	sw.defaultCase = b.enter(NodeMerge, "default", pos)
+}
+
+// EndCase ends the body of a case. Unless it was empty, whatever is still
+// open falls through into the next body.
+func (b *FlowBuilder) EndCase(empty bool) {
+	sw := b.switches[len(b.switches)-1]
+	sw.fall = b.open
+	if !empty {
+		sw.fall = make([]exit, 0, len(b.open))
+		for _, e := range b.open {
+			sw.fall = append(sw.fall, exit{node: e.node, label: "fallthrough", kind: EdgeFallthrough})
+		}
+	}
+	b.open = nil
+	b.block = nil
+}
+
+// EndSwitch leaves the switch through its breaks, the end of the last
+// case and, without a default case, the path where no case matched.
+func (b *FlowBuilder) EndSwitch() {
+	sw := b.switches[len(b.switches)-1]
+	b.switches = b.switches[:len(b.switches)-1]
+
+	b.open = nil
+	for _, e := range sw.fall {
+		if e.kind == EdgeFallthrough {
+			e = exit{node: e.node}
+		}
+		b.open = append(b.open, e)
+	}
+	if sw.defaultCase != nil {
+		for _, e := range sw.tests {
+			b.link(e.node, sw.defaultCase, e.label, e.kind)
+		}
+	} else {
+		b.open = append(b.open, sw.tests...)
+	}
+
+	// continue inside a switch acts like break
+	l := b.loops[len(b.loops)-1]
+	l.breaks = append(l.breaks, l.continues...)
+	b.EndLoop()
+}
+
+// MayThrow adds exceptional edges from the open exits to the catch
+// clauses and finally blocks of the enclosing try statements, for a
+// statement that calls code which may throw. Outside of try statements
+// this is not shown, every call could throw. Inside, what the catch
+// clauses are not sure to catch leaves through the throws node.
+func (b *FlowBuilder) MayThrow() {
+	b.raise("", "", false)
+}
+
+// Raise adds exceptional edges for an exception of class typ, empty when
+// not known, thrown from the open exits. Unless caught it leaves the
+// graph through its throws node.
+func (b *FlowBuilder) Raise(typ string) {
+	b.raise(typ, "", true)
+}
+
+// Throw raises an exception and ends the path.
+func (b *FlowBuilder) Throw(typ string) {
+	b.Raise(typ)
+	b.open = nil
+	b.block = nil
+}
+
+func (b *FlowBuilder) raise(typ, label string, explicit bool) {
+	if label == "" {
+		label = typ
+	}
+	if label == "" {
+		label = "exception"
+	}
+	exits := make([]exit, 0, len(b.open))
+	for _, e := range b.open {
+		exits = append(exits, exit{node: e.node, label: label, kind: EdgeException})
+	}
+	if len(exits) == 0 {
+		return
+	}
+
+	// a call may throw anywhere, which is only shown once a try statement
+	// is around it
+	shown := explicit
+	for i := len(b.tries) - 1; i >= 0; i-- {
+		t := b.tries[i]
+		if t.phase == tryFinally {
+			continue
+		}
+		if t.phase == tryBody {
+			shown = true
+			caught := false
+			for _, c := range t.catches {
+				match, certain := c.catches(typ)
+				if match {
+					c.entries = append(c.entries, exits...)
+				}
+				if certain {
+					caught = true
+					break
+				}
+			}
+			if caught {
+				return
+			}
+		}
+		if t.hasFinally {
+			t.finally = append(t.finally, exits...)
+			return
+		}
+	}
+
+	// what no catch clause is sure to catch leaves the graph
+	if !shown {
+		return
+	}
+	if b.graph.Throws == nil {
+		b.graph.Throws = b.newNode(NodeThrow, "throws", nil)
+	}
+	for _, e := range exits {
+		b.link(e.node, b.graph.Throws, e.label, e.kind)
+	}
+}
+
+// BeginTry starts a try statement with a catch clause per entry of
+// catches, listing the classes it catches.
+func (b *FlowBuilder) BeginTry(catches [][]string, hasFinally bool) {
+	t := &tryBlock{hasFinally: hasFinally, calls: len(b.returns)}
+	for _, types := range catches {
+		t.catches = append(t.catches, &catchClause{types: types})
+	}
+	b.tries = append(b.tries, t)
+	b.block = nil
+}
+
+// EndTryBody ends the try body. Exceptions thrown from now on are no longer
+// caught by the catch clauses of the statement.
+func (b *FlowBuilder) EndTryBody() {
+	t := b.tries[len(b.tries)-1]
+	t.ends = append(t.ends, b.open...)
+	t.phase = tryCatch
+	b.open = nil
+	b.block = nil
+}
+
+// BeginCatch starts the next catch clause, entered by the exceptions
+// routed to it from the try body.
+func (b *FlowBuilder) BeginCatch(label string, pos *position.Position) {
+	t := b.tries[len(b.tries)-1]
+	c := t.catches[t.next]
+	t.next++
+	b.open = c.entries
+	b.enter(NodeCatch, label, pos)
+}
+
+// EndCatch ends a catch clause completing normally.
+func (b *FlowBuilder) EndCatch() {
+	t := b.tries[len(b.tries)-1]
+	t.ends = append(t.ends, b.open...)
+	b.open = nil
+	b.block = nil
+}
+
+// BeginFinally starts the finally block, run after the try body and the
+// catch clauses as well as for the exceptions and return statements
+// leaving them.
+func (b *FlowBuilder) BeginFinally(pos *position.Position) {
+	t := b.tries[len(b.tries)-1]
+	t.phase = tryFinally
+	t.completes = len(t.ends) != 0
+	b.open = append(append(t.ends, t.finally...), t.returns...)
+	t.ends = nil
+	b.enter(NodeMerge, "finally", pos)
+}
+
+// EndTry ends the try statement. The exceptions that went through the
+// finally block are thrown again from its end, to the enclosing try
+// statements or out of the graph, and the return statements go on to
+// the enclosing finally blocks or leave the function.
+func (b *FlowBuilder) EndTry() {
+	t := b.tries[len(b.tries)-1]
+	b.tries = b.tries[:len(b.tries)-1]
+	if !t.hasFinally {
+		b.open = t.ends
+		b.block = nil
+		return
+	}
+	if len(t.finally) != 0 {
+		b.raise("", "rethrow", true)
+	}
+	if len(t.returns) != 0 {
+		exits := b.returning()
+		switch {
+		case b.leave(exits):
+		case b.InCall():
+			last := len(b.returns) - 1
+			b.returns[last] = append(b.returns[last], b.open...)
+		default:
+			b.leaving = append(b.leaving, exits...)
+		}
+	}
+	if !t.completes {
+		b.open = nil
+	}
+	b.block = nil
+}
+
+// text returns n printed for a label.
+func (b *FlowBuilder) text(n ast.Vertex) string {
+	return printPHP(b.src, n)
+}
+
+// sourceText returns the PHP source of n with runs of whitespace
+// collapsed.
+func sourceText(src []byte, n ast.Vertex) string {
+	pos := n.GetPosition()
+	if pos == nil || pos.StartPos < 0 || pos.EndPos > len(src) || pos.StartPos > pos.EndPos {
+		return ""
+	}
+	return strings.Join(strings.Fields(string(src[pos.StartPos:pos.EndPos])), " ")
+}
@@ -0,0 +1,414 @@
+package visualizephp
+
+import (
+	"strings"
+	"testing"
+)
+
+// buildFlow builds the flow of src as test.php, failing t on any error.
+func buildFlow(t *testing.T, src string) *Flow {
+	t.Helper()
+	flow, err := BuildFlow("test.php", []byte(src), Options{PHPVersion: "8.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return flow
+}
+
+func TestBuildFlow(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		graph string
+		want  string
+	}{
+		{
+			name: "if elseif else",
+			src: `<?php
+if ($a) { a(); } elseif ($b) { b(); } else { c(); }
+d();
+`,
+			graph: "{main}",
+			want: `
+  n0 start "{main}"
+  n1 decision "$a"
+  n2 block
+    a();
+  n3 decision "$b"
+  n4 block
+    b();
+  n5 block
+    c();
+  n6 merge
+  n7 block
+    d();
+  n8 end "end"
+  n0 -> n1
+  n1 -> n2 [true]
+  n1 -> n3 [false]
+  n3 -> n4 [true]
+  n3 -> n5 [false]
+  n2 -> n6
+  n4 -> n6
+  n5 -> n6
+  n6 -> n7
+  n7 -> n8
+`,
+		},
+		{
+			name: "break 2 and continue 2",
+			src: `<?php
+while ($a) {
+    foreach ($xs as $x) {
+        if ($x) { break 2; }
+        if (!$x) { continue 2; }
+        inner();
+    }
+    outer();
+}
+after();
+`,
+			graph: "{main}",
+			want: `
+  n0 start "{main}"
+  n1 loop "$a"
+  n2 loop "foreach $xs as $x"
+  n3 decision "$x"
+  n4 block
+    break 2;
+  n5 merge
+  n6 decision "!$x"
+  n7 block
+    continue 2;
+  n8 merge
+  n9 block
+    inner();
+  n10 block
+    outer();
+  n11 block
+    after();
+  n12 end "end"
+  n0 -> n1
+  n1 -> n2 [true]
+  n2 -> n3 [next]
+  n3 -> n4 [true]
+  n3 -> n5 [false]
+  n5 -> n6
+  n6 -> n7 [true]
+  n6 -> n8 [false]
+  n8 -> n9
+  n9 -> n2 (back)
+  n2 -> n10 [done]
+  n10 -> n1 (back)
+  n7 -> n1 (back)
+  n1 -> n11 [false]
+  n4 -> n11
+  n11 -> n12
+`,
+		},
+		{
+			name: "switch fallthrough",
+			src: `<?php
+switch ($k) {
+    case 1:
+        one();
+    case 2:
+        two();
+        break;
+    default:
+        other();
+}
+`,
+			graph: "{main}",
+			want: `
+  n0 start "{main}"
+  n1 decision "$k == 1"
+  n2 block
+    one();
+  n3 decision "$k == 2"
+  n4 block
+    two();
+    break;
+  n5 merge "default"
+  n6 block
+    other();
+  n7 end "end"
+  n0 -> n1
+  n1 -> n2 [true]
+  n1 -> n3 [false]
+  n3 -> n4 [true]
+  n2 -> n4 [fallthrough] (fallthrough)
+  n5 -> n6
+  n3 -> n5 [false]
+  n6 -> n7
+  n4 -> n7
+`,
+		},
+		{
+			name: "try catch finally",
+			src: `<?php
+try {
+    risky();
+} catch (FooException $e) {
+    handle($e);
+} finally {
+    cleanup();
+}
+`,
+			graph: "{main}",
+			want: `
+  n0 start "{main}"
+  n1 block
+    risky();
+  n2 catch "catch (FooException $e)"
+  n3 block
+    handle($e);
+  n4 merge "finally"
+  n5 block
+    cleanup();
+  n6 throw "throws"
+  n7 end "end"
+  n0 -> n1
+  n1 -> n2 [exception] (exception)
+  n2 -> n3
+  n1 -> n4
+  n3 -> n4
+  n1 -> n4 [exception] (exception)
+  n3 -> n4 [exception] (exception)
+  n4 -> n5
+  n5 -> n6 [rethrow] (exception)
+  n5 -> n7
+`,
+		},
+		{
+			name: "return through finally",
+			src: `<?php
+function h() {
+    try {
+        return a();
+    } finally {
+        cleanup();
+    }
+}
+`,
+			graph: "h",
+			want: `
+  n0 start "h"
+  n1 return "return a();"
+  n2 merge "finally"
+  n3 block
+    cleanup();
+  n4 throw "throws"
+  n5 end "end"
+  n0 -> n1
+  n1 -> n2 [exception] (exception)
+  n1 -> n2 [return]
+  n2 -> n3
+  n3 -> n4 [rethrow] (exception)
+  n3 -> n5 [return]
+`,
+		},
+		{
+			name: "throw after call",
+			src: `<?php
+function k() {
+    foo();
+    throw new X;
+}
+`,
+			graph: "k",
+			want: `
+  n0 start "k"
+  n1 block
+    foo();
+    throw new X;
+  n2 throw "throws"
+  n3 end "end"
+  n0 -> n1
+  n1 -> n2 [X] (exception)
+`,
+		},
+		{
+			name: "catch Throwable",
+			src: `<?php
+try {
+    risky();
+} catch (\Throwable $e) {
+    handle($e);
+}
+`,
+			graph: "{main}",
+			want: `
+  n0 start "{main}"
+  n1 block
+    risky();
+  n2 catch "catch (\\Throwable $e)"
+  n3 block
+    handle($e);
+  n4 end "end"
+  n0 -> n1
+  n1 -> n2 [exception] (exception)
+  n2 -> n3
+  n1 -> n4
+  n3 -> n4
+`,
+		},
+		{
+			name: "goto",
+			src: `<?php
+retry:
+$n--;
+if ($n > 0) {
+    goto retry;
+}
+`,
+			graph: "{main}",
+			want: `
+  n0 start "{main}"
+  n1 label "retry:"
+  n2 block
+    $n--;
+  n3 decision "$n > 0"
+  n4 block
+    goto retry;
+  n5 merge
+  n6 end "end"
+  n0 -> n1
+  n1 -> n2
+  n2 -> n3
+  n3 -> n4 [true]
+  n4 -> n1 [goto] (goto)
+  n3 -> n5 [false]
+  n5 -> n6
+`,
+		},
+		{
+			name: "goto undefined label",
+			src: `<?php
+if ($a) { goto nowhere; }
+after();
+`,
+			graph: "{main}",
+			want: `
+  n0 start "{main}"
+  n1 decision "$a"
+  n2 block
+    goto nowhere;
+  n3 merge
+  n4 block
+    after();
+  n5 exit "undefined label nowhere"
+  n6 end "end"
+  n0 -> n1
+  n1 -> n2 [true]
+  n1 -> n3 [false]
+  n3 -> n4
+  n2 -> n5 [goto] (goto)
+  n4 -> n6
+`,
+		},
+		{
+			name: "method",
+			src: `<?php
+namespace App;
+class Cart {
+    public function total() {
+        return $this->sum;
+    }
+}
+`,
+			graph: `App\Cart::total`,
+			want: `
+  n0 start "App\\Cart::total"
+  n1 return "return $this->sum;"
+  n2 end "end"
+  n0 -> n1
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flow := buildFlow(t, tt.src)
+			g := flow.Graph(tt.graph)
+			if g == nil {
+				t.Fatalf("no graph %s", tt.graph)
+			}
+			got := (&Flow{Graphs: []*Graph{g}}).String()
+			want := "graph " + tt.graph + tt.want
+			if got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestBuildFlowClosures(t *testing.T) {
+	flow := buildFlow(t, `<?php
+$f = function ($x) {
+    return $x;
+};
+$g = fn ($y) => $y * 2;
+`)
+	var names []string
+	for _, g := range flow.Graphs {
+		names = append(names, g.Name)
+	}
+	want := "{main}, {closure}@test.php:2, {closure}@test.php:5"
+	if got := strings.Join(names, ", "); got != want {
+		t.Errorf("got graphs %s, want %s", got, want)
+	}
+}
+
+func TestBuildFlowExpandedLoopCondition(t *testing.T) {
+	flow, err := BuildFlow("test.php", []byte(`<?php
+function more() { return next(); }
+while (more()) {
+    work();
+}
+`), Options{PHPVersion: "8.1", ExpandCalls: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := (&Flow{Graphs: []*Graph{flow.Graph("{main}")}}).String()
+	want := `graph {main}
+  n0 start "{main}"
+  n1 block
+    return next();
+  n2 loop "more()"
+  n3 block
+    work();
+  n4 end "end"
+  n0 -> n1
+  n1 -> n2
+  n2 -> n3 [true]
+  n3 -> n1 (back)
+  n2 -> n4 [false]
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestBuildFlowAfterSyntaxError(t *testing.T) {
+	// PHP 8 removed the (unset) cast, the parser giving up on the rest
+	// of the file after it
+	flow, err := BuildFlow("test.php", []byte(`<?php
+before();
+$x = (unset) $y;
+after();
+`), Options{PHPVersion: "8.0"})
+	errs, ok := err.(ParseErrors)
+	if !ok || len(errs) != 1 || errs[0].Line != 3 {
+		t.Fatalf("got error %v, want one at line 3", err)
+	}
+	var stmts []string
+	for _, n := range flow.Graph("{main}").Nodes {
+		for _, s := range n.Stmts {
+			stmts = append(stmts, s.Text)
+		}
+	}
+	want := "before(); after();"
+	if got := strings.Join(stmts, " "); got != want {
+		t.Errorf("got statements %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,261 @@
+package visualizephp
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// WriteHTML writes a single page showing the flowchart as inline SVG. The
+// page needs no network access: styles and scripts are inlined. Clicking
+// a node shows the PHP source it was built from.
+func WriteHTML(w io.Writer, flow *Flow, src []byte, file string) error {
+	var svg bytes.Buffer
+	if err := WriteSVG(&svg, flow); err != nil {
+		return err
+	}
+
+	lines := strings.Split(string(src), "\n")
+	// the lines of the inlined files, by path
+	included := make(map[string][]string)
+	page := htmlPage{
+		File:  file,
+		SVG:   template.HTML(svg.String()),
+		Nodes: make(map[string]htmlNode),
+	}
+	for i, g := range flow.Graphs {
+		graph := htmlGraph{Key: fmt.Sprintf("g%d", i), Name: g.Name}
+		for _, n := range g.Nodes {
+			key := nodeKey(i, n)
+			start, end := n.Span()
+			node := htmlNode{
+				Graph:     g.Name,
+				File:      file,
+				Kind:      n.Kind.String(),
+				StartLine: start,
+				EndLine:   end,
+			}
+			if n.Loc != nil {
+				node.StartLine, node.EndLine = n.Loc.StartLine, n.Loc.EndLine
+				if n.Loc.File != "" {
+					node.File = n.Loc.File
+				}
+			}
+			source := lines
+			// the nodes of a call expanded from the file itself have no path
+			if n.In != nil && n.In.Path != "" {
+				if n.Loc == nil {
+					node.File = n.In.Path
+				}
+				if included[n.In.Path] == nil {
+					included[n.In.Path] = strings.Split(string(n.In.Src), "\n")
+				}
+				source = included[n.In.Path]
+			}
+			if start, end := node.StartLine, node.EndLine; start > 0 && end <= len(source) {
+				node.Source = source[start-1 : end]
+				if n.Loc != nil {
+					node.StartColumn = characters(node.Source[0], n.Loc.StartColumn-1) + 1
+					node.EndColumn = characters(node.Source[len(node.Source)-1], n.Loc.EndColumn)
+				}
+			}
+			page.Nodes[key] = node
+
+			if n.Kind == NodeDecision || n.Kind == NodeLoop {
+				graph.Decisions = append(graph.Decisions, htmlDecision{Key: key, Label: n.Label})
+			}
+		}
+		page.Graphs = append(page.Graphs, graph)
+	}
+	return htmlTemplate.Execute(w, page)
+}
+
+// characters returns the number of characters in the first n bytes of
+// line, for the columns of the page, which count characters.
+func characters(line string, n int) int {
+	if n < 0 {
+		return 0
+	}
+	if n > len(line) {
+		n = len(line)
+	}
+	return utf8.RuneCountInString(line[:n])
+}
+
+type htmlPage struct {
+	File   string
+	SVG    template.HTML
+	Graphs []htmlGraph
+	Nodes  map[string]htmlNode
+}
+
+type htmlGraph struct {
+	Key       string
+	Name      string
+	Decisions []htmlDecision
+}
+
+type htmlDecision struct {
+	Key   string
+	Label string
+}
+
+type htmlNode struct {
+	Graph     string `json:"graph"`
+	File      string `json:"file"`
+	Kind      string `json:"kind"`
+	StartLine int    `json:"startLine"`
+	EndLine   int    `json:"endLine"`
+	// StartColumn and EndColumn are where the node starts on its first
+	// line and ends on its last, in characters, 0 when unknown.
+	StartColumn int      `json:"startColumn"`
+	EndColumn   int      `json:"endColumn"`
+	Source      []string `json:"source"`
+}
+
+var htmlTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.File}}</title>
+<style>
+  body { margin: 0; display: flex; height: 100vh; font-family: sans-serif; }
+  #tree { width: 16em; overflow: auto; border-right: 1px solid #ccc; padding: 0.5em; }
+  #tree ul { list-style: none; margin: 0; padding-left: 1em; }
+  #tree a { cursor: pointer; color: #0645ad; text-decoration: none; font-family: monospace; }
+  #chart { flex: 1; overflow: hidden; cursor: grab; }
+  #chart svg { width: 100%; height: 100%; }
+  #chart g.node { cursor: pointer; }
+  #chart g.node.selected polygon, #chart g.node.selected ellipse, #chart g.node.selected path { stroke: #0645ad; stroke-width: 3; }
+  #source { width: 30em; overflow: auto; border-left: 1px solid #ccc; padding: 0.5em; }
+  #source pre { margin: 0; }
+  #source mark { background: #fff3a8; }
+  #source .line { color: #888; user-select: none; display: inline-block; width: 4em; text-align: right; padding-right: 1em; }
+</style>
+</head>
+<body>
+<nav id="tree">
+  <details open>
+    <summary>{{.File}}</summary>
+    <ul>
+    {{- range .Graphs}}
+      <li>
+        <details>
+          <summary><a data-zoom="{{.Key}}">{{.Name}}</a></summary>
+          <ul>
+          {{- range .Decisions}}
+            <li><a data-node="{{.Key}}">{{.Label}}</a></li>
+          {{- end}}
+          </ul>
+        </details>
+      </li>
+    {{- end}}
+    </ul>
+  </details>
+</nav>
+<main id="chart">{{.SVG}}</main>
+<aside id="source"><p>Click a node to see its source.</p></aside>
+<script>
+(function () {
+  const nodes = {{.Nodes}};
+  const svg = document.querySelector("#chart svg");
+  const source = document.getElementById("source");
+  svg.removeAttribute("width");
+  svg.removeAttribute("height");
+
+  let box = svg.viewBox.baseVal;
+  let view = { x: box.x, y: box.y, w: box.width, h: box.height };
+  function apply() {
+    svg.setAttribute("viewBox", view.x + " " + view.y + " " + view.w + " " + view.h);
+  }
+
+  // zoom around the pointer
+  svg.addEventListener("wheel", function (e) {
+    e.preventDefault();
+    const scale = e.deltaY < 0 ? 0.9 : 1.1;
+    const r = svg.getBoundingClientRect();
+    const px = view.x + (e.clientX - r.left) / r.width * view.w;
+    const py = view.y + (e.clientY - r.top) / r.height * view.h;
+    view.x = px - (px - view.x) * scale;
+    view.y = py - (py - view.y) * scale;
+    view.w *= scale;
+    view.h *= scale;
+    apply();
+  });
+
+  let drag = null;
+  svg.addEventListener("mousedown", function (e) {
+    drag = { x: e.clientX, y: e.clientY, view: Object.assign({}, view) };
+  });
+  window.addEventListener("mousemove", function (e) {
+    if (!drag) return;
+    const r = svg.getBoundingClientRect();
+    view.x = drag.view.x - (e.clientX - drag.x) / r.width * view.w;
+    view.y = drag.view.y - (e.clientY - drag.y) / r.height * view.h;
+    apply();
+  });
+  window.addEventListener("mouseup", function () { drag = null; });
+
+  // zoom to an element, in the coordinates of the svg element
+  function zoomTo(el) {
+    const b = el.getBBox();
+    const m = svg.getScreenCTM().inverse().multiply(el.getScreenCTM());
+    const p1 = new DOMPoint(b.x, b.y).matrixTransform(m);
+    const p2 = new DOMPoint(b.x + b.width, b.y + b.height).matrixTransform(m);
+    const margin = 20;
+    view = { x: p1.x - margin, y: p1.y - margin, w: p2.x - p1.x + 2 * margin, h: p2.y - p1.y + 2 * margin };
+    apply();
+  }
+
+  function escape(s) {
+    return s.replace(/&/g, "&amp;").replace(/</g, "&lt;").replace(/>/g, "&gt;");
+  }
+
+  function show(key) {
+    document.querySelectorAll("#chart g.node.selected").forEach(function (el) {
+      el.classList.remove("selected");
+    });
+    const el = document.getElementById(key);
+    if (el) el.classList.add("selected");
+
+    const node = nodes[key];
+    if (!node || !node.startLine) {
+      source.innerHTML = "<p>" + (node ? escape(node.kind) : "") + " node without source.</p>";
+      return;
+    }
+    let html = "<h3>" + escape(node.file + ":" + node.startLine) + "</h3><p>" + escape(node.graph + ", " + node.kind) + "</p><pre>";
+    const lines = node.source || [];
+    lines.forEach(function (line, i) {
+      // highlight the columns of the node, the whole line when unknown
+      const from = i === 0 && node.startColumn ? node.startColumn - 1 : 0;
+      const to = i === lines.length - 1 && node.endColumn ? node.endColumn : line.length;
+      html += '<span class="line">' + (node.startLine + i) + "</span>" + escape(line.slice(0, from)) +
+        "<mark>" + escape(line.slice(from, to)) + "</mark>" + escape(line.slice(to)) + "\n";
+    });
+    source.innerHTML = html + "</pre>";
+  }
+
+  document.querySelectorAll("#chart g.node").forEach(function (el) {
+    el.addEventListener("click", function () { show(el.id); });
+  });
+  document.querySelectorAll("#tree a[data-zoom]").forEach(function (a) {
+    a.addEventListener("click", function () {
+      const el = document.getElementById(a.dataset.zoom);
+      if (el) zoomTo(el);
+    });
+  });
+  document.querySelectorAll("#tree a[data-node]").forEach(function (a) {
+    a.addEventListener("click", function () {
+      const el = document.getElementById(a.dataset.node);
+      if (el) zoomTo(el);
+      show(a.dataset.node);
+    });
+  });
+})();
+</script>
+</body>
+</html>
+`))
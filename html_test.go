@@ -0,0 +1,26 @@
+package visualizephp
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTMLScript(t *testing.T) {
+	src := "<?php\nif ($a) {\n    echo 'a';\n}\n"
+	var out bytes.Buffer
+	if err := WriteHTML(&out, buildFlow(t, src), []byte(src), "test.php"); err != nil {
+		t.Fatal(err)
+	}
+	page := out.String()
+	start, end := strings.Index(page, "<script>"), strings.LastIndex(page, "</script>")
+	if start < 0 || end < start {
+		t.Fatal("no script in the page")
+	}
+	// the source panel must not be shadowed where the script fills it
+	decls := regexp.MustCompile(`\b(const|let|var)\s+source\b`).FindAllString(page[start:end], -1)
+	if len(decls) != 1 {
+		t.Errorf("got %d declarations of source, want 1: %q", len(decls), decls)
+	}
+}
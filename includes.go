@@ -0,0 +1,398 @@
+package visualizephp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/VKCOM/php-parser/pkg/ast"
+	"github.com/VKCOM/php-parser/pkg/position"
+	"github.com/VKCOM/php-parser/pkg/visitor"
+	"github.com/VKCOM/php-parser/pkg/visitor/traverser"
+)
+
+// SourceFile is a PHP file reached from the entrypoint.
+type SourceFile struct {
+	// Path is cleaned and absolute.
+	Path string
+	Src  []byte
+	// Root is nil when the file could not be read or parsed.
+	Root *ast.Root
+	// Errors are the syntax errors the parser recovered from.
+	Errors ParseErrors
+	// Missing is set when no file exists at Path.
+	Missing bool
+	// Err is why the file could not be read or parsed.
+	Err error
+}
+
+// Include is an include or require expression.
+type Include struct {
+	From *SourceFile
+	// To is nil when the path is only known at run time.
+	To *SourceFile
+	// Kind is include, include_once, require or require_once.
+	Kind string
+	// Expr is the source of the path expression.
+	Expr string
+	Pos  *position.Position
+	// Cycle is set on the include closing a cycle back to a file that
+	// includes this one.
+	Cycle bool
+}
+
+// IncludeGraph holds the files reached from an entrypoint through
+// include and require, the entrypoint first.
+type IncludeGraph struct {
+	Files    []*SourceFile
+	Includes []*Include
+}
+
+// BuildIncludeGraph parses entry and, recursively, the files it includes.
+// phpVersion is the version given to PHPVersion for each file. Only an
+// entrypoint that cannot be read is an error, the other files that cannot
+// be read are kept in the graph.
+func BuildIncludeGraph(entry string, phpVersion string) (*IncludeGraph, error) {
+	path, err := filepath.Abs(entry)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	b := newIncludeBuilder(phpVersion)
+	b.visit(b.file(path))
+	return b.graph, nil
+}
+
+type includeBuilder struct {
+	graph *IncludeGraph
+	files map[string]*SourceFile
+	// onPath are the files being visited, including the one being visited.
+	onPath     map[*SourceFile]bool
+	phpVersion string
+}
+
+func newIncludeBuilder(phpVersion string) *includeBuilder {
+	return &includeBuilder{
+		graph:      &IncludeGraph{},
+		files:      make(map[string]*SourceFile),
+		onPath:     make(map[*SourceFile]bool),
+		phpVersion: phpVersion,
+	}
+}
+
+// file returns the file at path, reading and parsing it the first time.
+func (b *includeBuilder) file(path string) *SourceFile {
+	if f, ok := b.files[path]; ok {
+		return f
+	}
+	f := &SourceFile{Path: path}
+	b.files[path] = f
+	b.graph.Files = append(b.graph.Files, f)
+
+	f.Src, f.Err = ioutil.ReadFile(path)
+	if f.Err != nil {
+		f.Missing = os.IsNotExist(f.Err)
+		return f
+	}
+	v, err := PHPVersion(path, f.Src, b.phpVersion)
+	if err != nil {
+		f.Err = err
+		return f
+	}
+	f.Root, f.Err = ParseFile(f.Src, v)
+	if errs, ok := f.Err.(ParseErrors); ok && f.Root != nil {
+		f.Errors, f.Err = errs, nil
+	}
+	return f
+}
+
+func (b *includeBuilder) visit(f *SourceFile) {
+	if f.Root == nil {
+		return
+	}
+	b.onPath[f] = true
+	finder := &includeFinder{}
+	traverser.NewTraverser(finder).Traverse(f.Root)
+	for _, inc := range finder.includes {
+		edge := &Include{
+			From: f,
+			Kind: inc.kind,
+			Expr: printPHP(f.Src, inc.expr),
+			Pos:  inc.pos,
+		}
+		b.graph.Includes = append(b.graph.Includes, edge)
+
+		path, ok := includePath(inc.expr, f.Path)
+		if !ok {
+			continue
+		}
+		_, seen := b.files[path]
+		edge.To = b.file(path)
+		edge.Cycle = b.onPath[edge.To]
+		if !seen {
+			b.visit(edge.To)
+		}
+	}
+	delete(b.onPath, f)
+}
+
+// inliner keeps the files AstReader.InlineIncludes inlines.
+type inliner struct {
+	files *includeBuilder
+	// file is the file being read.
+	file string
+	// active are the files being inlined, which are not inlined again
+	// into themselves.
+	active map[string]bool
+	// declared are the functions already given a graph, by file and
+	// offset, as a file may be inlined more than once.
+	declared map[string]bool
+}
+
+func newInliner(file, phpVersion string) *inliner {
+	return &inliner{
+		files:    newIncludeBuilder(phpVersion),
+		file:     file,
+		active:   map[string]bool{file: true},
+		declared: make(map[string]bool),
+	}
+}
+
+// declare tells whether the function declared at pos of the file being
+// read is met for the first time.
+func (in *inliner) declare(pos *position.Position) bool {
+	if in == nil || pos == nil {
+		return true
+	}
+	key := fmt.Sprintf("%s:%d", in.file, pos.StartPos)
+	if in.declared[key] {
+		return false
+	}
+	in.declared[key] = true
+	return true
+}
+
+type foundInclude struct {
+	kind string
+	expr ast.Vertex
+	pos  *position.Position
+}
+
+// includeFinder collects the include and require expressions of a tree.
+type includeFinder struct {
+	visitor.Null
+	includes []foundInclude
+}
+
+func (f *includeFinder) ExprInclude(n *ast.ExprInclude) {
+	f.includes = append(f.includes, foundInclude{"include", n.Expr, n.Position})
+}
+
+func (f *includeFinder) ExprIncludeOnce(n *ast.ExprIncludeOnce) {
+	f.includes = append(f.includes, foundInclude{"include_once", n.Expr, n.Position})
+}
+
+func (f *includeFinder) ExprRequire(n *ast.ExprRequire) {
+	f.includes = append(f.includes, foundInclude{"require", n.Expr, n.Position})
+}
+
+func (f *includeFinder) ExprRequireOnce(n *ast.ExprRequireOnce) {
+	f.includes = append(f.includes, foundInclude{"require_once", n.Expr, n.Position})
+}
+
+// includePath works out the file an include expression in file refers
+// to. It knows string literals, __DIR__, __FILE__, dirname() and the
+// concatenation of those; relative paths are taken from the directory of
+// file.
+func includePath(expr ast.Vertex, file string) (string, bool) {
+	path, ok := staticString(expr, file, nil)
+	if !ok || path == "" {
+		return "", false
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(file), path)
+	}
+	return filepath.Clean(path), true
+}
+
+// staticString evaluates a string expression that does not depend on run
+// time values, but for the variables in vars, named with their $.
+func staticString(expr ast.Vertex, file string, vars map[string]string) (string, bool) {
+	switch n := expr.(type) {
+	case *ast.ExprVariable:
+		v, ok := vars[nameString(n.Name)]
+		return v, ok
+	case *ast.ScalarString:
+		return unquote(n.Value)
+	case *ast.ScalarMagicConstant:
+		switch strings.ToUpper(string(n.Value)) {
+		case "__DIR__":
+			return filepath.Dir(file), true
+		case "__FILE__":
+			return file, true
+		}
+	case *ast.ExprBrackets:
+		return staticString(n.Expr, file, vars)
+	case *ast.ExprBinaryConcat:
+		left, ok := staticString(n.Left, file, vars)
+		if !ok {
+			return "", false
+		}
+		right, ok := staticString(n.Right, file, vars)
+		return left + right, ok
+	case *ast.ExprFunctionCall:
+		if strings.ToLower(strings.TrimPrefix(nameString(n.Function), `\`)) != "dirname" || len(n.Args) == 0 || len(n.Args) > 2 {
+			return "", false
+		}
+		path, ok := staticString(n.Args[0].(*ast.Argument).Expr, file, vars)
+		if !ok {
+			return "", false
+		}
+		levels := 1
+		if len(n.Args) == 2 {
+			lnumber, ok := n.Args[1].(*ast.Argument).Expr.(*ast.ScalarLnumber)
+			if !ok {
+				return "", false
+			}
+			if levels, _ = strconv.Atoi(string(lnumber.Value)); levels < 1 {
+				return "", false
+			}
+		}
+		for ; levels > 0; levels-- {
+			path = filepath.Dir(path)
+		}
+		return path, true
+	}
+	return "", false
+}
+
+// unquote returns the value of a string literal, which is not static when
+// it is a double quoted string with variables.
+func unquote(lit []byte) (string, bool) {
+	s := string(lit)
+	if len(s) < 2 {
+		return "", false
+	}
+	switch s[0] {
+	case '\'':
+		return strings.NewReplacer(`\\`, `\`, `\'`, `'`).Replace(s[1 : len(s)-1]), true
+	case '"':
+		return strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\$`, `$`).Replace(s[1 : len(s)-1]), true
+	}
+	return "", false
+}
+
+// WriteIncludeDot writes the include graph in Graphviz DOT format. Files
+// are named relative to the directory of the entrypoint.
+func WriteIncludeDot(w io.Writer, g *IncludeGraph) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "digraph includes {")
+	fmt.Fprintln(out, `  node [fontname="monospace", shape=box];`)
+	fmt.Fprintln(out, `  edge [fontname="monospace"];`)
+	ids := includeIDs(g)
+	for _, f := range g.Files {
+		fmt.Fprintf(out, "  %s [%s];\n", ids[f], includeDotAttrs(g, f))
+	}
+	for i, inc := range g.Includes {
+		to := ids[inc.To]
+		if inc.To == nil {
+			to = fmt.Sprintf("u%d", i)
+			fmt.Fprintf(out, "  %s [shape=note, style=dashed, label=%s];\n", to, dotQuote("unknown include\n"+inc.Expr))
+		}
+		attrs := "label=" + dotQuote(includeEdgeLabel(inc))
+		if inc.Cycle {
+			attrs += ", color=red, penwidth=2"
+		}
+		fmt.Fprintf(out, "  %s -> %s [%s];\n", ids[inc.From], to, attrs)
+	}
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+func includeDotAttrs(g *IncludeGraph, f *SourceFile) string {
+	label := dotQuote(includeFileLabel(g, f))
+	switch {
+	case f.Missing:
+		return "color=red, style=dashed, label=" + label
+	case f.Err != nil:
+		return "color=red, style=filled, fillcolor=mistyrose, label=" + label
+	case f == g.Files[0]:
+		return "peripheries=2, label=" + label
+	}
+	return "label=" + label
+}
+
+// WriteIncludeMermaid writes the include graph as a Mermaid flowchart.
+func WriteIncludeMermaid(w io.Writer, g *IncludeGraph) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "flowchart TD")
+	ids := includeIDs(g)
+	var styles []string
+	for _, f := range g.Files {
+		fmt.Fprintf(out, "  %s[%s]\n", ids[f], mermaidQuote(includeFileLabel(g, f)))
+		switch {
+		case f.Missing:
+			styles = append(styles, fmt.Sprintf("  style %s stroke:red,stroke-dasharray:5", ids[f]))
+		case f.Err != nil:
+			styles = append(styles, fmt.Sprintf("  style %s fill:mistyrose,stroke:red", ids[f]))
+		}
+	}
+	for i, inc := range g.Includes {
+		to := ids[inc.To]
+		if inc.To == nil {
+			to = fmt.Sprintf("u%d", i)
+			fmt.Fprintf(out, "  %s[/%s/]\n", to, mermaidQuote("unknown include: "+inc.Expr))
+			styles = append(styles, fmt.Sprintf("  style %s stroke-dasharray:5", to))
+		}
+		fmt.Fprintf(out, "  %s -->|%s| %s\n", ids[inc.From], mermaidQuote(includeEdgeLabel(inc)), to)
+		if inc.Cycle {
+			styles = append(styles, fmt.Sprintf("  linkStyle %d stroke:red,stroke-width:3px", i))
+		}
+	}
+	for _, style := range styles {
+		fmt.Fprintln(out, style)
+	}
+	return out.Flush()
+}
+
+func includeIDs(g *IncludeGraph) map[*SourceFile]string {
+	ids := make(map[*SourceFile]string, len(g.Files))
+	for i, f := range g.Files {
+		ids[f] = fmt.Sprintf("f%d", i)
+	}
+	return ids
+}
+
+// includeFileLabel names f relative to the directory of the entrypoint,
+// saying why it could not be read.
+func includeFileLabel(g *IncludeGraph, f *SourceFile) string {
+	name := f.Path
+	if rel, err := filepath.Rel(filepath.Dir(g.Files[0].Path), f.Path); err == nil {
+		name = rel
+	}
+	switch {
+	case f.Missing:
+		return "missing: " + name
+	case f.Err != nil:
+		return "unparseable: " + name
+	}
+	return name
+}
+
+func includeEdgeLabel(inc *Include) string {
+	label := inc.Kind
+	if inc.Pos != nil {
+		label += fmt.Sprintf(" :%d", inc.Pos.StartLine)
+	}
+	if inc.Cycle {
+		label += " (cycle)"
+	}
+	return label
+}
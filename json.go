@@ -0,0 +1,565 @@
+package visualizephp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/VKCOM/php-parser/pkg/position"
+)
+
+// The diagrams are written to JSON with the nodes, functions and files
+// they point to given by index, and read back the same. Kinds are written
+// by name. The source code is left out: a flow read back draws the same
+// in every format, but WriteHTML cannot show the source of its nodes.
+
+// JSONRenderer writes diagrams as indented JSON, which json.Unmarshal
+// reads back into a diagram of the same type.
+type JSONRenderer struct{}
+
+func (JSONRenderer) Render(w io.Writer, d Diagram) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// span is a position, with the keys of the parser's JSON dumps.
+type span struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+	StartPos  int `json:"startPos"`
+	EndPos    int `json:"endPos"`
+}
+
+func newSpan(pos *position.Position) *span {
+	if pos == nil {
+		return nil
+	}
+	return &span{pos.StartLine, pos.EndLine, pos.StartPos, pos.EndPos}
+}
+
+func (s *span) position() *position.Position {
+	if s == nil {
+		return nil
+	}
+	return &position.Position{StartLine: s.StartLine, EndLine: s.EndLine, StartPos: s.StartPos, EndPos: s.EndPos}
+}
+
+// unmarshalKind sets kind to the kind below end whose name is text.
+func unmarshalKind(text []byte, end int, name func(int) string, kind *int) error {
+	for k := 0; k < end; k++ {
+		if name(k) == string(text) {
+			*kind = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown kind %q", text)
+}
+
+func (k NodeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *NodeKind) UnmarshalText(text []byte) error {
+	kind := int(*k)
+	err := unmarshalKind(text, int(NodeRecursion)+1, func(i int) string { return NodeKind(i).String() }, &kind)
+	*k = NodeKind(kind)
+	return err
+}
+
+func (k EdgeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *EdgeKind) UnmarshalText(text []byte) error {
+	kind := int(*k)
+	err := unmarshalKind(text, int(EdgeGoto)+1, func(i int) string { return EdgeKind(i).String() }, &kind)
+	*k = EdgeKind(kind)
+	return err
+}
+
+func (k FunctionKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *FunctionKind) UnmarshalText(text []byte) error {
+	kind := int(*k)
+	err := unmarshalKind(text, int(FuncMethod)+1, func(i int) string { return FunctionKind(i).String() }, &kind)
+	*k = FunctionKind(kind)
+	return err
+}
+
+func (k ClassKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *ClassKind) UnmarshalText(text []byte) error {
+	kind := int(*k)
+	err := unmarshalKind(text, int(KindEnum)+1, func(i int) string { return ClassKind(i).String() }, &kind)
+	*k = ClassKind(kind)
+	return err
+}
+
+type jsonFlow struct {
+	Graphs []jsonGraph `json:"graphs"`
+	// Inclusions are the inclusions of every graph, the nodes of a
+	// function declared in an inlined file being in the inclusion of the
+	// graph including it.
+	Inclusions []jsonInclusion `json:"inclusions,omitempty"`
+}
+
+type jsonGraph struct {
+	Name       string     `json:"name"`
+	Params     []*Param   `json:"params,omitempty"`
+	Returns    string     `json:"returns,omitempty"`
+	Start      *int       `json:"start,omitempty"`
+	End        *int       `json:"end,omitempty"`
+	Throws     *int       `json:"throws,omitempty"`
+	Nodes      []jsonNode `json:"nodes"`
+	Edges      []jsonEdge `json:"edges"`
+	Inclusions []int      `json:"inclusions,omitempty"`
+}
+
+type jsonNode struct {
+	Kind  NodeKind        `json:"kind"`
+	Label string          `json:"label,omitempty"`
+	Stmts []jsonStatement `json:"stmts,omitempty"`
+	Loc   *Location       `json:"loc,omitempty"`
+	In    *int            `json:"in,omitempty"`
+}
+
+type jsonStatement struct {
+	Text   string    `json:"text"`
+	Output bool      `json:"output,omitempty"`
+	Loc    *Location `json:"loc,omitempty"`
+}
+
+type jsonEdge struct {
+	From  int       `json:"from"`
+	To    int       `json:"to"`
+	Label string    `json:"label,omitempty"`
+	Kind  EdgeKind  `json:"kind"`
+	Loc   *Location `json:"loc,omitempty"`
+}
+
+type jsonInclusion struct {
+	Path   string `json:"path,omitempty"`
+	Call   string `json:"call,omitempty"`
+	Parent *int   `json:"parent,omitempty"`
+}
+
+func (f Flow) MarshalJSON() ([]byte, error) {
+	var v jsonFlow
+	inclusions := make(map[*Inclusion]int)
+	var inclusion func(inc *Inclusion) *int
+	inclusion = func(inc *Inclusion) *int {
+		if inc == nil {
+			return nil
+		}
+		i, ok := inclusions[inc]
+		if !ok {
+			parent := inclusion(inc.Parent)
+			i = len(v.Inclusions)
+			inclusions[inc] = i
+			v.Inclusions = append(v.Inclusions, jsonInclusion{Path: inc.Path, Call: inc.Call, Parent: parent})
+		}
+		return &i
+	}
+
+	for _, g := range f.Graphs {
+		jg := jsonGraph{Name: g.Name, Params: g.Params, Returns: g.Returns, Start: nodeID(g.Start), End: nodeID(g.End), Throws: nodeID(g.Throws)}
+		for _, inc := range g.Inclusions {
+			jg.Inclusions = append(jg.Inclusions, *inclusion(inc))
+		}
+		for _, n := range g.Nodes {
+			jn := jsonNode{Kind: n.Kind, Label: n.Label, Loc: n.Loc, In: inclusion(n.In)}
+			for _, s := range n.Stmts {
+				jn.Stmts = append(jn.Stmts, jsonStatement{s.Text, s.Output, s.Loc})
+			}
+			jg.Nodes = append(jg.Nodes, jn)
+		}
+		for _, e := range g.Edges {
+			jg.Edges = append(jg.Edges, jsonEdge{e.From.ID, e.To.ID, e.Label, e.Kind, e.Loc})
+		}
+		v.Graphs = append(v.Graphs, jg)
+	}
+	return json.Marshal(v)
+}
+
+// nodeID returns the ID of n, nil for a nil n.
+func nodeID(n *Node) *int {
+	if n == nil {
+		return nil
+	}
+	return &n.ID
+}
+
+func (f *Flow) UnmarshalJSON(data []byte) error {
+	var v jsonFlow
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	// parents come before their children
+	inclusions := make([]*Inclusion, len(v.Inclusions))
+	for i, ji := range v.Inclusions {
+		inclusions[i] = &Inclusion{Path: ji.Path, Call: ji.Call}
+		if ji.Parent != nil {
+			if *ji.Parent >= i {
+				return errors.New("inclusion before its parent")
+			}
+			inclusions[i].Parent = inclusions[*ji.Parent]
+		}
+	}
+	inclusion := func(i *int) (*Inclusion, error) {
+		if i == nil {
+			return nil, nil
+		}
+		if *i < 0 || *i >= len(inclusions) {
+			return nil, fmt.Errorf("no inclusion %d", *i)
+		}
+		return inclusions[*i], nil
+	}
+
+	*f = Flow{}
+	for _, jg := range v.Graphs {
+		g := &Graph{Name: jg.Name, Params: jg.Params, Returns: jg.Returns}
+		for i, jn := range jg.Nodes {
+			n := &Node{ID: i, Kind: jn.Kind, Label: jn.Label, Loc: jn.Loc}
+			for _, s := range jn.Stmts {
+				n.Stmts = append(n.Stmts, Statement{Text: s.Text, Output: s.Output, Loc: s.Loc})
+			}
+			var err error
+			if n.In, err = inclusion(jn.In); err != nil {
+				return err
+			}
+			g.Nodes = append(g.Nodes, n)
+		}
+		node := func(i int) (*Node, error) {
+			if i < 0 || i >= len(g.Nodes) {
+				return nil, fmt.Errorf("graph %s: no node %d", g.Name, i)
+			}
+			return g.Nodes[i], nil
+		}
+		// the start, end and throws nodes may be missing
+		optional := func(i *int) (*Node, error) {
+			if i == nil {
+				return nil, nil
+			}
+			return node(*i)
+		}
+		var err error
+		if g.Start, err = optional(jg.Start); err != nil {
+			return err
+		}
+		if g.End, err = optional(jg.End); err != nil {
+			return err
+		}
+		if g.Throws, err = optional(jg.Throws); err != nil {
+			return err
+		}
+		for _, je := range jg.Edges {
+			e := &Edge{Label: je.Label, Kind: je.Kind, Loc: je.Loc}
+			if e.From, err = node(je.From); err != nil {
+				return err
+			}
+			if e.To, err = node(je.To); err != nil {
+				return err
+			}
+			g.Edges = append(g.Edges, e)
+		}
+		for id, i := range jg.Inclusions {
+			inc, err := inclusion(&i)
+			if err != nil {
+				return err
+			}
+			inc.ID = id
+			g.Inclusions = append(g.Inclusions, inc)
+		}
+		f.Graphs = append(f.Graphs, g)
+	}
+	return nil
+}
+
+// files numbers the files of a diagram in the order they are met.
+type files struct {
+	index map[*SourceFile]int
+	paths []string
+}
+
+func (fs *files) add(f *SourceFile) *int {
+	if f == nil {
+		return nil
+	}
+	if fs.index == nil {
+		fs.index = make(map[*SourceFile]int)
+	}
+	i, ok := fs.index[f]
+	if !ok {
+		i = len(fs.paths)
+		fs.index[f] = i
+		fs.paths = append(fs.paths, f.Path)
+	}
+	return &i
+}
+
+// sourceFiles returns the files at paths, read back.
+func sourceFiles(paths []string) []*SourceFile {
+	files := make([]*SourceFile, len(paths))
+	for i, path := range paths {
+		files[i] = &SourceFile{Path: path}
+	}
+	return files
+}
+
+func fileAt(files []*SourceFile, i *int) (*SourceFile, error) {
+	if i == nil {
+		return nil, nil
+	}
+	if *i < 0 || *i >= len(files) {
+		return nil, fmt.Errorf("no file %d", *i)
+	}
+	return files[*i], nil
+}
+
+type jsonCallGraph struct {
+	Files      []string       `json:"files,omitempty"`
+	Functions  []jsonFunction `json:"functions"`
+	Calls      []jsonCall     `json:"calls"`
+	Unresolved []jsonCall     `json:"unresolved,omitempty"`
+}
+
+type jsonFunction struct {
+	Name string       `json:"name"`
+	Kind FunctionKind `json:"kind"`
+	File *int         `json:"file,omitempty"`
+	Pos  *span        `json:"pos,omitempty"`
+}
+
+type jsonCall struct {
+	Caller    int    `json:"caller"`
+	Callee    *int   `json:"callee,omitempty"`
+	Name      string `json:"name"`
+	Pos       *span  `json:"pos,omitempty"`
+	Ambiguous bool   `json:"ambiguous,omitempty"`
+}
+
+func (g CallGraph) MarshalJSON() ([]byte, error) {
+	var v jsonCallGraph
+	var fs files
+	functions := make(map[*Function]int)
+	for i, f := range g.Functions {
+		functions[f] = i
+		v.Functions = append(v.Functions, jsonFunction{f.Name, f.Kind, fs.add(f.File), newSpan(f.Pos)})
+	}
+	call := func(c *Call) (jsonCall, error) {
+		caller, ok := functions[c.Caller]
+		if !ok {
+			return jsonCall{}, fmt.Errorf("call of %s from outside the graph", c.Name)
+		}
+		jc := jsonCall{Caller: caller, Name: c.Name, Pos: newSpan(c.Pos), Ambiguous: c.Ambiguous}
+		if c.Callee != nil {
+			callee, ok := functions[c.Callee]
+			if !ok {
+				return jsonCall{}, fmt.Errorf("call of %s outside the graph", c.Callee.Name)
+			}
+			jc.Callee = &callee
+		}
+		return jc, nil
+	}
+	for _, list := range []struct {
+		calls []*Call
+		to    *[]jsonCall
+	}{{g.Calls, &v.Calls}, {g.Unresolved, &v.Unresolved}} {
+		for _, c := range list.calls {
+			jc, err := call(c)
+			if err != nil {
+				return nil, err
+			}
+			*list.to = append(*list.to, jc)
+		}
+	}
+	v.Files = fs.paths
+	return json.Marshal(v)
+}
+
+func (g *CallGraph) UnmarshalJSON(data []byte) error {
+	var v jsonCallGraph
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*g = CallGraph{byName: make(map[string]*Function)}
+	files := sourceFiles(v.Files)
+	for _, jf := range v.Functions {
+		file, err := fileAt(files, jf.File)
+		if err != nil {
+			return err
+		}
+		g.add(&Function{Name: jf.Name, Kind: jf.Kind, File: file, Pos: jf.Pos.position()})
+	}
+	if len(g.Functions) != len(v.Functions) {
+		return errors.New("function declared twice")
+	}
+	function := func(i int) (*Function, error) {
+		if i < 0 || i >= len(g.Functions) {
+			return nil, fmt.Errorf("no function %d", i)
+		}
+		return g.Functions[i], nil
+	}
+	for _, list := range []struct {
+		calls []jsonCall
+		to    *[]*Call
+	}{{v.Calls, &g.Calls}, {v.Unresolved, &g.Unresolved}} {
+		for _, jc := range list.calls {
+			c := &Call{Name: jc.Name, Pos: jc.Pos.position(), Ambiguous: jc.Ambiguous}
+			var err error
+			if c.Caller, err = function(jc.Caller); err != nil {
+				return err
+			}
+			if jc.Callee != nil {
+				if c.Callee, err = function(*jc.Callee); err != nil {
+					return err
+				}
+			}
+			*list.to = append(*list.to, c)
+		}
+	}
+	return nil
+}
+
+// Class writes its file by path, the other fields as they are.
+
+func (c Class) MarshalJSON() ([]byte, error) {
+	type class Class
+	v := struct {
+		class
+		File string `json:"file,omitempty"`
+		Pos  *span  `json:"pos,omitempty"`
+	}{class: class(c), Pos: newSpan(c.Pos)}
+	if c.File != nil {
+		v.File = c.File.Path
+	}
+	return json.Marshal(v)
+}
+
+func (c *Class) UnmarshalJSON(data []byte) error {
+	type class Class
+	v := struct {
+		*class
+		File string `json:"file,omitempty"`
+		Pos  *span  `json:"pos,omitempty"`
+	}{class: (*class)(c)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	c.File, c.Pos = nil, v.Pos.position()
+	if v.File != "" {
+		c.File = &SourceFile{Path: v.File}
+	}
+	return nil
+}
+
+type jsonIncludeGraph struct {
+	Files    []jsonSourceFile `json:"files"`
+	Includes []jsonInclude    `json:"includes"`
+}
+
+type jsonSourceFile struct {
+	Path    string           `json:"path"`
+	Errors  []jsonParseError `json:"errors,omitempty"`
+	Missing bool             `json:"missing,omitempty"`
+	Err     string           `json:"err,omitempty"`
+}
+
+type jsonParseError struct {
+	Msg    string `json:"msg"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	Pos    *span  `json:"pos,omitempty"`
+}
+
+type jsonInclude struct {
+	From  int    `json:"from"`
+	To    *int   `json:"to,omitempty"`
+	Kind  string `json:"kind"`
+	Expr  string `json:"expr"`
+	Pos   *span  `json:"pos,omitempty"`
+	Cycle bool   `json:"cycle,omitempty"`
+}
+
+func (g IncludeGraph) MarshalJSON() ([]byte, error) {
+	var v jsonIncludeGraph
+	files := make(map[*SourceFile]int)
+	for i, f := range g.Files {
+		files[f] = i
+		jf := jsonSourceFile{Path: f.Path, Missing: f.Missing}
+		for _, e := range f.Errors {
+			jf.Errors = append(jf.Errors, jsonParseError{e.Msg, e.Line, e.Column, newSpan(e.Pos)})
+		}
+		if f.Err != nil {
+			jf.Err = f.Err.Error()
+		}
+		v.Files = append(v.Files, jf)
+	}
+	file := func(f *SourceFile) (*int, error) {
+		if f == nil {
+			return nil, nil
+		}
+		i, ok := files[f]
+		if !ok {
+			return nil, fmt.Errorf("include of %s outside the graph", f.Path)
+		}
+		return &i, nil
+	}
+	for _, inc := range g.Includes {
+		ji := jsonInclude{Kind: inc.Kind, Expr: inc.Expr, Pos: newSpan(inc.Pos), Cycle: inc.Cycle}
+		from, err := file(inc.From)
+		if err != nil {
+			return nil, err
+		}
+		if from == nil {
+			return nil, errors.New("include from no file")
+		}
+		ji.From = *from
+		if ji.To, err = file(inc.To); err != nil {
+			return nil, err
+		}
+		v.Includes = append(v.Includes, ji)
+	}
+	return json.Marshal(v)
+}
+
+func (g *IncludeGraph) UnmarshalJSON(data []byte) error {
+	var v jsonIncludeGraph
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*g = IncludeGraph{}
+	var paths []string
+	for _, jf := range v.Files {
+		paths = append(paths, jf.Path)
+	}
+	g.Files = sourceFiles(paths)
+	for i, jf := range v.Files {
+		f := g.Files[i]
+		f.Missing = jf.Missing
+		for _, e := range jf.Errors {
+			f.Errors = append(f.Errors, &ParseError{Msg: e.Msg, Line: e.Line, Column: e.Column, Pos: e.Pos.position()})
+		}
+		if jf.Err != "" {
+			f.Err = errors.New(jf.Err)
+		}
+	}
+	for _, ji := range v.Includes {
+		inc := &Include{Kind: ji.Kind, Expr: ji.Expr, Pos: ji.Pos.position(), Cycle: ji.Cycle}
+		var err error
+		if inc.From, err = fileAt(g.Files, &ji.From); err != nil {
+			return err
+		}
+		if inc.To, err = fileAt(g.Files, ji.To); err != nil {
+			return err
+		}
+		g.Includes = append(g.Includes, inc)
+	}
+	return nil
+}
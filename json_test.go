@@ -0,0 +1,68 @@
+package visualizephp
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestFlowJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"branches", `<?php
+function greet(string $name = "you"): string {
+    if ($name == '') { return 'hi'; }
+    switch ($name) { case 'a': echo 1; case 'b': echo 2; break; }
+    return "hi $name";
+}
+echo greet();
+`},
+		{"loops", `<?php
+foreach ($xs as $x) { while ($x--) { if ($x) continue 2; } }
+do { $i++; } while ($i < 3);
+`},
+		{"exceptions", `<?php
+try { risky(); } catch (FooException | BarException $e) { throw $e; } finally { cleanup(); }
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, err := json.Marshal(buildFlow(t, tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var back Flow
+			if err := json.Unmarshal(first, &back); err != nil {
+				t.Fatal(err)
+			}
+			second, err := json.Marshal(&back)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(first, second) {
+				t.Errorf("got\n%s\nwant\n%s", second, first)
+			}
+		})
+	}
+}
+
+func TestFlowJSONWithoutEnd(t *testing.T) {
+	start := &Node{ID: 0, Kind: NodeStart, Label: "partial"}
+	flow := &Flow{Graphs: []*Graph{{Name: "partial", Start: start, Nodes: []*Node{start}}}}
+	data, err := json.Marshal(flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(`"end"`)) {
+		t.Errorf("got %s, want no end", data)
+	}
+	var back Flow
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if g := back.Graphs[0]; g.Start != g.Nodes[0] || g.End != nil {
+		t.Errorf("got start %v and end %v, want node 0 and none", g.Start, g.End)
+	}
+}
@@ -0,0 +1,486 @@
+package visualizephp
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Sizes used by the layout, in SVG user units. Text is measured assuming a
+// monospace font of fontSize.
+const (
+	fontSize   = 12.0
+	charWidth  = 7.2
+	lineHeight = 15.0
+	nodePad    = 8.0
+	nodeSep    = 30.0
+	rankSep    = 45.0
+	dummyWidth = 12.0
+	// sweeps is the number of down and up passes ordering the layers and
+	// placing the nodes.
+	sweeps = 8
+)
+
+type point struct {
+	x, y float64
+}
+
+// layoutNode is a node of a graph, or a dummy node carrying an edge
+// across a layer, with its position. x and y are the center.
+type layoutNode struct {
+	node  *Node
+	layer int
+	order int
+	x, y  float64
+	w, h  float64
+	// up and down are the neighbors in the layers above and below once
+	// cycles are broken and long edges split.
+	up, down []*layoutNode
+}
+
+type layoutEdge struct {
+	edge *Edge
+	// reversed is set for the edges turned around to break cycles, drawn
+	// against the flow on the right of the nodes.
+	reversed bool
+	points   []point
+}
+
+// graphLayout is a graph laid out in layers from top to bottom.
+type graphLayout struct {
+	graph  *Graph
+	nodes  []*layoutNode
+	edges  []*layoutEdge
+	layers [][]*layoutNode
+	width  float64
+	height float64
+}
+
+// layoutGraph places the nodes of g in layers the way Sugiyama et al.
+// describe: cycles are broken by reversing back edges, nodes are layered by
+// longest path, edges longer than one layer get dummy nodes, the order
+// within layers is improved by barycenter sweeps and nodes are moved
+// towards their neighbors. Everything is done in node and edge order so
+// the same graph always gets the same layout.
+func layoutGraph(g *Graph) *graphLayout {
+	l := &graphLayout{graph: g}
+	for _, n := range g.Nodes {
+		w, h := nodeSize(n)
+		l.nodes = append(l.nodes, &layoutNode{node: n, w: w, h: h})
+	}
+
+	reversed := l.backEdges()
+	l.assignLayers(reversed)
+	chains := l.splitEdges(reversed)
+	l.orderLayers()
+	l.placeNodes()
+	l.routeEdges(reversed, chains)
+	return l
+}
+
+// outgoing lists the edges leaving each node, in edge order.
+func (l *graphLayout) outgoing() [][]*Edge {
+	out := make([][]*Edge, len(l.nodes))
+	for _, e := range l.graph.Edges {
+		out[e.From.ID] = append(out[e.From.ID], e)
+	}
+	return out
+}
+
+// backEdges finds the edges closing a cycle by a depth first search from
+// the start node, then from the nodes it did not reach.
+func (l *graphLayout) backEdges() map[*Edge]bool {
+	out := l.outgoing()
+	const (
+		unvisited = iota
+		onStack
+		done
+	)
+	state := make([]int, len(l.nodes))
+	reversed := make(map[*Edge]bool)
+
+	var visit func(n int)
+	visit = func(n int) {
+		state[n] = onStack
+		for _, e := range out[n] {
+			switch state[e.To.ID] {
+			case unvisited:
+				visit(e.To.ID)
+			case onStack:
+				reversed[e] = true
+			}
+		}
+		state[n] = done
+	}
+	if l.graph.Start != nil {
+		visit(l.graph.Start.ID)
+	}
+	for n := range l.nodes {
+		if state[n] == unvisited {
+			visit(n)
+		}
+	}
+	return reversed
+}
+
+// assignLayers puts every node one layer below its lowest predecessor.
+func (l *graphLayout) assignLayers(reversed map[*Edge]bool) {
+	preds := make([][]int, len(l.nodes))
+	succs := make([][]int, len(l.nodes))
+	for _, e := range l.graph.Edges {
+		from, to := e.From.ID, e.To.ID
+		if from == to {
+			continue
+		}
+		if reversed[e] {
+			from, to = to, from
+		}
+		preds[to] = append(preds[to], from)
+		succs[from] = append(succs[from], to)
+	}
+
+	// Kahn's algorithm, taking ready nodes by ID
+	remaining := make([]int, len(l.nodes))
+	var ready []int
+	for n := range l.nodes {
+		remaining[n] = len(preds[n])
+		if remaining[n] == 0 {
+			ready = append(ready, n)
+		}
+	}
+	for len(ready) != 0 {
+		sort.Ints(ready)
+		n := ready[0]
+		ready = ready[1:]
+		for _, p := range preds[n] {
+			if layer := l.nodes[p].layer + 1; layer > l.nodes[n].layer {
+				l.nodes[n].layer = layer
+			}
+		}
+		for _, s := range succs[n] {
+			remaining[s]--
+			if remaining[s] == 0 {
+				ready = append(ready, s)
+			}
+		}
+	}
+}
+
+// splitEdges adds a dummy node per layer crossed by an edge and returns
+// the chain of nodes each edge goes through, top to bottom.
+func (l *graphLayout) splitEdges(reversed map[*Edge]bool) map[*Edge][]*layoutNode {
+	chains := make(map[*Edge][]*layoutNode)
+	for _, e := range l.graph.Edges {
+		if e.From == e.To {
+			continue
+		}
+		top, bottom := l.nodes[e.From.ID], l.nodes[e.To.ID]
+		if reversed[e] {
+			top, bottom = bottom, top
+		}
+		chain := []*layoutNode{top}
+		for layer := top.layer + 1; layer < bottom.layer; layer++ {
+			dummy := &layoutNode{layer: layer, w: dummyWidth}
+			l.nodes = append(l.nodes, dummy)
+			chain = append(chain, dummy)
+		}
+		chain = append(chain, bottom)
+		for i := 1; i < len(chain); i++ {
+			chain[i-1].down = append(chain[i-1].down, chain[i])
+			chain[i].up = append(chain[i].up, chain[i-1])
+		}
+		chains[e] = chain
+	}
+	return chains
+}
+
+// orderLayers fills the layers, then sorts every layer by the average
+// position of the neighbors in the layer before, sweeping down and up and
+// keeping the order with the fewest crossings.
+func (l *graphLayout) orderLayers() {
+	for _, n := range l.nodes {
+		for n.layer >= len(l.layers) {
+			l.layers = append(l.layers, nil)
+		}
+		l.layers[n.layer] = append(l.layers[n.layer], n)
+	}
+	l.renumber()
+
+	best := l.saveOrder()
+	bestCrossings := l.crossings()
+	for i := 0; i < sweeps && bestCrossings > 0; i++ {
+		for layer := 1; layer < len(l.layers); layer++ {
+			sortByBarycenter(l.layers[layer], func(n *layoutNode) []*layoutNode { return n.up })
+		}
+		for layer := len(l.layers) - 2; layer >= 0; layer-- {
+			sortByBarycenter(l.layers[layer], func(n *layoutNode) []*layoutNode { return n.down })
+		}
+		l.renumber()
+		if c := l.crossings(); c < bestCrossings {
+			best, bestCrossings = l.saveOrder(), c
+		}
+	}
+	l.layers = best
+	l.renumber()
+}
+
+func (l *graphLayout) renumber() {
+	for _, layer := range l.layers {
+		for i, n := range layer {
+			n.order = i
+		}
+	}
+}
+
+func (l *graphLayout) saveOrder() [][]*layoutNode {
+	saved := make([][]*layoutNode, len(l.layers))
+	for i, layer := range l.layers {
+		saved[i] = append([]*layoutNode(nil), layer...)
+	}
+	return saved
+}
+
+// crossings counts the pairs of edges crossing between adjacent layers.
+func (l *graphLayout) crossings() int {
+	count := 0
+	for _, layer := range l.layers {
+		type segment struct{ from, to int }
+		var segments []segment
+		for _, n := range layer {
+			for _, d := range n.down {
+				segments = append(segments, segment{n.order, d.order})
+			}
+		}
+		for i := range segments {
+			for j := i + 1; j < len(segments); j++ {
+				a, b := segments[i], segments[j]
+				if (a.from < b.from && a.to > b.to) || (a.from > b.from && a.to < b.to) {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+func sortByBarycenter(layer []*layoutNode, neighbors func(*layoutNode) []*layoutNode) {
+	center := make(map[*layoutNode]float64, len(layer))
+	for _, n := range layer {
+		ns := neighbors(n)
+		if len(ns) == 0 {
+			center[n] = float64(n.order)
+			continue
+		}
+		sum := 0.0
+		for _, m := range ns {
+			sum += float64(m.order)
+		}
+		center[n] = sum / float64(len(ns))
+	}
+	sort.SliceStable(layer, func(i, j int) bool {
+		return center[layer[i]] < center[layer[j]]
+	})
+}
+
+// placeNodes gives every layer a row and moves the nodes of a layer as
+// close to the average of their neighbors as the order and spacing of the
+// layer allow.
+func (l *graphLayout) placeNodes() {
+	y := 0.0
+	for _, layer := range l.layers {
+		h := 0.0
+		for _, n := range layer {
+			if n.h > h {
+				h = n.h
+			}
+		}
+		x := 0.0
+		for _, n := range layer {
+			n.x = x + n.w/2
+			n.y = y + h/2
+			x += n.w + nodeSep
+		}
+		y += h + rankSep
+	}
+
+	for i := 0; i < sweeps; i++ {
+		for layer := 1; layer < len(l.layers); layer++ {
+			alignLayer(l.layers[layer], func(n *layoutNode) []*layoutNode { return n.up })
+		}
+		for layer := len(l.layers) - 2; layer >= 0; layer-- {
+			alignLayer(l.layers[layer], func(n *layoutNode) []*layoutNode { return n.down })
+		}
+	}
+
+	// shift everything to start at the origin
+	minX := 0.0
+	first := true
+	for _, n := range l.nodes {
+		if left := n.x - n.w/2; first || left < minX {
+			minX, first = left, false
+		}
+	}
+	for _, n := range l.nodes {
+		n.x -= minX
+		if right := n.x + n.w/2; right > l.width {
+			l.width = right
+		}
+	}
+	if y > rankSep {
+		l.height = y - rankSep
+	}
+}
+
+// alignLayer moves the nodes of a layer as close as possible to the mean
+// x of their neighbors while keeping their order and spacing. This is an
+// isotonic regression, solved by pooling adjacent violators.
+func alignLayer(layer []*layoutNode, neighbors func(*layoutNode) []*layoutNode) {
+	if len(layer) == 0 {
+		return
+	}
+	// offset[i] is the least distance from the first node to node i, so
+	// x[i] - offset[i] must not decrease along the layer
+	offset := make([]float64, len(layer))
+	for i := 1; i < len(layer); i++ {
+		offset[i] = offset[i-1] + layer[i-1].w/2 + nodeSep + layer[i].w/2
+	}
+
+	type block struct {
+		sum   float64
+		count int
+	}
+	var blocks []block
+	for i, n := range layer {
+		want := n.x
+		if ns := neighbors(n); len(ns) != 0 {
+			want = 0
+			for _, m := range ns {
+				want += m.x
+			}
+			want /= float64(len(ns))
+		}
+		blocks = append(blocks, block{want - offset[i], 1})
+		for len(blocks) > 1 {
+			last, prev := blocks[len(blocks)-1], blocks[len(blocks)-2]
+			if prev.sum/float64(prev.count) <= last.sum/float64(last.count) {
+				break
+			}
+			blocks = blocks[:len(blocks)-2]
+			blocks = append(blocks, block{prev.sum + last.sum, prev.count + last.count})
+		}
+	}
+
+	i := 0
+	for _, b := range blocks {
+		for k := 0; k < b.count; k++ {
+			layer[i].x = b.sum/float64(b.count) + offset[i]
+			i++
+		}
+	}
+}
+
+// routeEdges turns the chains of nodes into polylines. Edges going down
+// leave their source at the bottom and enter their target at the top,
+// edges reversed to break cycles run on the right of the nodes.
+func (l *graphLayout) routeEdges(reversed map[*Edge]bool, chains map[*Edge][]*layoutNode) {
+	for _, e := range l.graph.Edges {
+		le := &layoutEdge{edge: e, reversed: reversed[e]}
+		l.edges = append(l.edges, le)
+
+		if e.From == e.To {
+			n := l.nodes[e.From.ID]
+			right := n.x + n.w/2
+			le.points = []point{
+				{right, n.y - n.h/4},
+				{right + 20, n.y - n.h/4},
+				{right + 20, n.y + n.h/4},
+				{right, n.y + n.h/4},
+			}
+			continue
+		}
+
+		chain := chains[e]
+		top, bottom := chain[0], chain[len(chain)-1]
+		var points []point
+		if le.reversed {
+			points = append(points, point{top.x + top.w/2, top.y}, point{top.x + top.w/2 + 15, top.y})
+			for _, d := range chain[1 : len(chain)-1] {
+				points = append(points, point{d.x, d.y})
+			}
+			points = append(points, point{bottom.x + bottom.w/2 + 15, bottom.y}, point{bottom.x + bottom.w/2, bottom.y})
+			// the edge goes from bottom to top
+			for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+				points[i], points[j] = points[j], points[i]
+			}
+		} else {
+			next := bottom
+			if len(chain) > 2 {
+				next = chain[1]
+			}
+			prev := top
+			if len(chain) > 2 {
+				prev = chain[len(chain)-2]
+			}
+			points = append(points, point{top.x + clamp(next.x-top.x, top.w/4), top.y + top.h/2})
+			for _, d := range chain[1 : len(chain)-1] {
+				points = append(points, point{d.x, d.y})
+			}
+			points = append(points, point{bottom.x + clamp(prev.x-bottom.x, bottom.w/4), bottom.y - bottom.h/2})
+		}
+		le.points = points
+	}
+}
+
+func clamp(v, limit float64) float64 {
+	if v > limit {
+		return limit
+	}
+	if v < -limit {
+		return -limit
+	}
+	return v
+}
+
+// nodeLines returns the lines of text shown in a node.
+func nodeLines(n *Node) []string {
+	if n.Kind == NodeBlock {
+		lines := make([]string, 0, len(n.Stmts))
+		for _, s := range n.Stmts {
+			lines = append(lines, strings.Split(s.Text, "\n")...)
+		}
+		return lines
+	}
+	if n.Label == "" {
+		return nil
+	}
+	return strings.Split(n.Label, "\n")
+}
+
+// nodeSize returns the width and height of the shape drawn for n.
+func nodeSize(n *Node) (w, h float64) {
+	if n.Kind == NodeMerge && n.Label == "" {
+		return 10, 10
+	}
+	lines := nodeLines(n)
+	longest := 0
+	for _, line := range lines {
+		if c := utf8.RuneCountInString(line); c > longest {
+			longest = c
+		}
+	}
+	w = float64(longest)*charWidth + 2*nodePad
+	h = float64(len(lines))*lineHeight + 2*nodePad
+	switch n.Kind {
+	case NodeDecision, NodeLoop:
+		// the text has to fit in the middle of the diamond
+		w, h = w*1.6, h*1.6
+	case NodeStart, NodeEnd, NodeReturn, NodeThrow:
+		w += 2 * nodePad
+	case NodeExit:
+		w += 2 * h / 3
+	}
+	if n.Output() || n.Kind == NodeLabel {
+		w += h
+	}
+	return w, h
+}
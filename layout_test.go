@@ -0,0 +1,61 @@
+package visualizephp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// dumpLayout writes down where l puts every node and edge.
+func dumpLayout(l *graphLayout) string {
+	var sb strings.Builder
+	for _, n := range l.nodes {
+		id := -1
+		if n.node != nil {
+			id = n.node.ID
+		}
+		fmt.Fprintf(&sb, "n%d %d/%d %.1f,%.1f\n", id, n.layer, n.order, n.x, n.y)
+	}
+	for _, e := range l.edges {
+		fmt.Fprintf(&sb, "n%d->n%d %v %v\n", e.edge.From.ID, e.edge.To.ID, e.reversed, e.points)
+	}
+	fmt.Fprintf(&sb, "%.1fx%.1f\n", l.width, l.height)
+	return sb.String()
+}
+
+func TestLayoutDeterministic(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"branches", `<?php
+if ($a) { a(); } elseif ($b) { b(); } else { c(); }
+switch ($k) { case 1: one(); case 2: two(); break; default: other(); }
+`},
+		{"loops", `<?php
+while ($a) {
+    foreach ($xs as $x) {
+        if ($x) { break 2; }
+        if (!$x) { continue 2; }
+        inner();
+    }
+    do { $i++; } while ($i < 3);
+}
+`},
+		{"exceptions", `<?php
+try { risky(); other(); } catch (FooException $e) { handle($e); } finally { cleanup(); }
+retry:
+if (--$n > 0) { goto retry; }
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := dumpLayout(layoutGraph(buildFlow(t, tt.src).Graphs[0]))
+			for i := 0; i < 10; i++ {
+				if got := dumpLayout(layoutGraph(buildFlow(t, tt.src).Graphs[0])); got != want {
+					t.Fatalf("layout %d differs:\n%s\nfirst:\n%s", i, got, want)
+				}
+			}
+		})
+	}
+}
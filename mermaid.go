@@ -0,0 +1,127 @@
+package visualizephp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteMermaid writes the flow as a Mermaid flowchart, one subgraph per
+// graph, ready to be pasted into Markdown.
+func WriteMermaid(w io.Writer, flow *Flow) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "flowchart TD")
+
+	// linkStyle refers to edges by their index in the whole chart
+	var styles []string
+	edges := 0
+	for i, g := range flow.Graphs {
+		fmt.Fprintf(out, "  subgraph g%d[%s]\n", i, mermaidQuote(g.Name))
+		styles = writeMermaidNodes(out, i, g, nil, "    ", styles)
+		fmt.Fprintln(out, "  end")
+		for _, e := range g.Edges {
+			arrow := "-->"
+			switch e.Kind {
+			case EdgeBack, EdgeGoto:
+				arrow = "-.->"
+			case EdgeFallthrough:
+				arrow = "==>"
+				styles = append(styles, fmt.Sprintf("  linkStyle %d stroke:orange,stroke-width:3px", edges))
+			case EdgeException:
+				arrow = "-.->"
+				styles = append(styles, fmt.Sprintf("  linkStyle %d stroke:red", edges))
+			}
+			if e.Label != "" {
+				arrow += "|" + mermaidQuote(e.Label) + "|"
+			}
+			fmt.Fprintf(out, "  %s %s %s\n", nodeKey(i, e.From), arrow, nodeKey(i, e.To))
+			edges++
+		}
+	}
+	for _, style := range styles {
+		fmt.Fprintln(out, style)
+	}
+	return out.Flush()
+}
+
+// writeMermaidNodes writes the nodes drawn in the inlined file parent, or
+// at the top level of the graph when parent is nil, and a nested subgraph
+// for each file inlined there. It returns styles with the ones of the
+// nodes added.
+func writeMermaidNodes(out *bufio.Writer, i int, g *Graph, parent *Inclusion, indent string, styles []string) []string {
+	for _, n := range g.Nodes {
+		if g.cluster(n) != parent {
+			continue
+		}
+		fmt.Fprintf(out, "%s%s%s\n", indent, nodeKey(i, n), mermaidShape(n))
+		if n.Kind == NodeUnparseable {
+			styles = append(styles, fmt.Sprintf("  style %s fill:mistyrose,stroke:red", nodeKey(i, n)))
+		}
+	}
+	for _, inc := range g.Inclusions {
+		if g.own(inc.Parent) != parent {
+			continue
+		}
+		fmt.Fprintf(out, "%ssubgraph %s[%s]\n", indent, inclusionKey(i, inc), mermaidQuote(inc.Name()))
+		styles = writeMermaidNodes(out, i, g, inc, indent+"  ", styles)
+		fmt.Fprintf(out, "%send\n", indent)
+		styles = append(styles, fmt.Sprintf("  style %s stroke-dasharray:5", inclusionKey(i, inc)))
+	}
+	return styles
+}
+
+// mermaidShape returns the shape and text of a node, using the same
+// shapes as WriteDot where Mermaid has them.
+func mermaidShape(n *Node) string {
+	label := mermaidQuote(n.Label)
+	switch n.Kind {
+	case NodeStart, NodeEnd:
+		return "([" + label + "])"
+	case NodeDecision, NodeLoop:
+		return "{" + label + "}"
+	case NodeBlock:
+		lines := make([]string, 0, len(n.Stmts))
+		for _, s := range n.Stmts {
+			lines = append(lines, mermaidEscape(s.Text))
+		}
+		text := `"` + strings.Join(lines, "<br/>") + `"`
+		if n.Output() {
+			return "[/" + text + "/]"
+		}
+		return "[" + text + "]"
+	case NodeMerge:
+		if n.Label == "" {
+			return `((" "))`
+		}
+		return "(" + label + ")"
+	case NodeReturn:
+		return "(((" + label + ")))"
+	case NodeExit:
+		return "{{" + label + "}}"
+	case NodeThrow:
+		return ">" + label + "]"
+	case NodeLabel:
+		return "[/" + label + `\]`
+	case NodeRecursion:
+		return "[[" + label + "]]"
+	}
+	return "[" + label + "]"
+}
+
+func mermaidQuote(s string) string {
+	return `"` + mermaidEscape(s) + `"`
+}
+
+// mermaidEscape replaces the characters Mermaid would read as markup by
+// entity codes, so PHP strings like "'my name'" survive in labels, and
+// line breaks by <br/>.
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(
+		"#", "#35;",
+		`"`, "#quot;",
+		"<", "#lt;",
+		">", "#gt;",
+		"\n", "<br/>",
+	).Replace(s)
+}
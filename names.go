@@ -0,0 +1,221 @@
+package visualizephp
+
+import (
+	"strings"
+
+	"github.com/VKCOM/php-parser/pkg/ast"
+	"github.com/VKCOM/php-parser/pkg/position"
+)
+
+// nameKind tells the three kinds of names PHP imports and resolves
+// separately apart.
+type nameKind int
+
+const (
+	nameClass nameKind = iota
+	nameFunction
+	nameConst
+)
+
+// useDecl is a name imported by a use statement.
+type useDecl struct {
+	kind nameKind
+	// alias is the lower case name the import is known by, lower case
+	// but for constants, which are case-sensitive.
+	alias string
+	// name is the imported name with its namespace.
+	name string
+	// ns is the namespace statement the import is in, nil for a file
+	// without any.
+	ns *ast.StmtNamespace
+}
+
+// addUses records the imports of a use statement, group use statements
+// having a prefix.
+func (d *fileDecls) addUses(pos *position.Position, typ, prefix ast.Vertex, uses []ast.Vertex) {
+	ns := d.namespaceStmtAt(pos)
+	for _, u := range uses {
+		u, ok := u.(*ast.StmtUse)
+		if !ok {
+			continue
+		}
+		kind := useKind(typ)
+		if u.Type != nil {
+			kind = useKind(u.Type)
+		}
+		name := strings.TrimPrefix(nameString(u.Use), `\`)
+		if prefix != nil {
+			name = strings.TrimPrefix(nameString(prefix), `\`) + `\` + name
+		}
+		alias := name[strings.LastIndex(name, `\`)+1:]
+		if u.Alias != nil {
+			alias = nameString(u.Alias)
+		}
+		if kind != nameConst {
+			alias = strings.ToLower(alias)
+		}
+		d.uses = append(d.uses, useDecl{kind: kind, alias: alias, name: name, ns: ns})
+	}
+}
+
+// useKind returns the kind of the names imported by use function and use
+// const, class for a plain use.
+func useKind(typ ast.Vertex) nameKind {
+	switch strings.ToLower(nameString(typ)) {
+	case "function":
+		return nameFunction
+	case "const":
+		return nameConst
+	}
+	return nameClass
+}
+
+// imported returns the name alias is imported as in the namespace
+// statement ns, "" when it is not imported.
+func (d *fileDecls) imported(kind nameKind, alias string, ns *ast.StmtNamespace) string {
+	if kind != nameConst {
+		alias = strings.ToLower(alias)
+	}
+	for _, u := range d.uses {
+		if u.kind == kind && u.alias == alias && u.ns == ns {
+			return u.name
+		}
+	}
+	return ""
+}
+
+// resolve returns the fully qualified name, without leading backslash,
+// that a name of kind written at pos refers to. Names are resolved as PHP
+// does: a fully qualified name is taken as it is, the first part of a
+// qualified name may be an imported class or namespace, and the others
+// are relative to the current namespace. For an unqualified function or
+// constant that is not imported, global is the name in the global
+// namespace PHP falls back to when the current namespace has none.
+func (d *fileDecls) resolve(kind nameKind, name string, pos *position.Position) (fq, global string) {
+	ns := d.namespaceStmtAt(pos)
+	current := namespaceName(ns)
+	switch {
+	case strings.HasPrefix(name, `\`):
+		return strings.TrimPrefix(name, `\`), ""
+	case strings.HasPrefix(strings.ToLower(name), `namespace\`):
+		return joinNamespace(current, name[len(`namespace\`):]), ""
+	case strings.Contains(name, `\`):
+		i := strings.Index(name, `\`)
+		if imported := d.imported(nameClass, name[:i], ns); imported != "" {
+			return imported + name[i:], ""
+		}
+		return joinNamespace(current, name), ""
+	}
+	if imported := d.imported(kind, name, ns); imported != "" {
+		return imported, ""
+	}
+	if kind != nameClass && current != "" {
+		return joinNamespace(current, name), name
+	}
+	return joinNamespace(current, name), ""
+}
+
+// classRef returns the class a name written at pos refers to, with its
+// namespace.
+func (d *fileDecls) classRef(name string, pos *position.Position) string {
+	fq, _ := d.resolve(nameClass, name, pos)
+	return fq
+}
+
+// namespaceStmtAt returns the namespace statement the code at pos is in,
+// nil for code outside any. A namespace statement without braces holds
+// the code up to the next one.
+func (d *fileDecls) namespaceStmtAt(pos *position.Position) *ast.StmtNamespace {
+	var ns *ast.StmtNamespace
+	for _, n := range d.namespaces {
+		if n.Position.StartPos > pos.StartPos {
+			break
+		}
+		braced := n.OpenCurlyBracketTkn != nil
+		if braced && !contains(n.Position, pos) {
+			continue
+		}
+		ns = n
+	}
+	return ns
+}
+
+// namespaceAt returns the namespace the code at pos is in, "" for the
+// global one.
+func (d *fileDecls) namespaceAt(pos *position.Position) string {
+	return namespaceName(d.namespaceStmtAt(pos))
+}
+
+// qualify returns name declared at pos with the namespace it is in.
+func (d *fileDecls) qualify(name string, pos *position.Position) string {
+	return joinNamespace(d.namespaceAt(pos), name)
+}
+
+// namespaceName returns the name a namespace statement opens, "" for the
+// global namespace.
+func namespaceName(n *ast.StmtNamespace) string {
+	if n == nil || n.Name == nil {
+		return ""
+	}
+	return nameString(n.Name)
+}
+
+func joinNamespace(ns, name string) string {
+	if ns == "" {
+		return name
+	}
+	return ns + `\` + name
+}
+
+// referencedClasses returns the classes the file of d refers to by name,
+// with their namespace, in the order of first reference.
+func (d *fileDecls) referencedClasses() []string {
+	var classes []string
+	seen := make(map[string]bool)
+	addFQ := func(fq string) {
+		if key := strings.ToLower(fq); !seen[key] {
+			seen[key] = true
+			classes = append(classes, fq)
+		}
+	}
+	add := func(name string, pos *position.Position) {
+		switch strings.ToLower(name) {
+		case "", "self", "static", "parent":
+			return
+		}
+		addFQ(d.classRef(name, pos))
+	}
+	for _, u := range d.uses {
+		if u.kind == nameClass {
+			addFQ(u.name)
+		}
+	}
+	for _, c := range d.classes {
+		var names []ast.Vertex
+		switch c := c.(type) {
+		case *ast.StmtClass:
+			names = append([]ast.Vertex{c.Extends}, c.Implements...)
+		case *ast.StmtInterface:
+			names = c.Extends
+		case *ast.StmtEnum:
+			names = c.Implements
+		}
+		for _, n := range names {
+			add(nameString(n), c.GetPosition())
+		}
+	}
+	for _, u := range d.traitUses {
+		for _, t := range u.Traits {
+			add(nameString(t), u.Position)
+		}
+	}
+	for _, c := range d.methodCalls {
+		if c, ok := c.(*ast.ExprStaticCall); ok {
+			add(nameString(c.Class), c.Position)
+		}
+	}
+	for _, n := range d.classNames {
+		add(nameString(n), n.GetPosition())
+	}
+	return classes
+}
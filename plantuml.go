@@ -0,0 +1,572 @@
+package visualizephp
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WritePlantUML writes the flow as a PlantUML activity diagram, a
+// partition per graph. Decisions whose branches meet again are drawn as
+// if and switch, loop headers as while and repeat, and a break leaving
+// the innermost loop as break. Activity diagrams have no arrows going
+// elsewhere, so continue, break 2, goto and fallthrough into a case
+// already drawn end in a connector, a circle named after the node they
+// lead to, and the same circle comes before that node. Exception edges
+// are notes naming the connector of the catch they lead to.
+func WritePlantUML(w io.Writer, flow *Flow) error {
+	out := bufio.NewWriter(w)
+	out.WriteString("@startuml\n")
+	for _, g := range flow.Graphs {
+		p := newPlantUMLGraph(g)
+		p.graph()
+		out.WriteString(`partition "` + plantUMLEscape(g.Name) + "\" {\n")
+		p.write(out)
+		out.WriteString("}\n")
+	}
+	out.WriteString("@enduml\n")
+	return out.Flush()
+}
+
+// plantUMLGraph turns a graph back into the nested blocks of an activity
+// diagram.
+type plantUMLGraph struct {
+	g *Graph
+	// next are the edges leaving each node but the exception edges,
+	// which are in throws, and prev the edges of next reaching each node.
+	next, prev, throws map[*Node][]*Edge
+	// pdom are the post-dominators of the nodes, from where the graph
+	// ends: its end, or its returns when nothing reaches the end.
+	pdom map[*Node]map[*Node]bool
+	// loops are the loops being drawn, the innermost last.
+	loops   []*plantUMLLoop
+	emitted map[*Node]bool
+	// jumped are the nodes a connector leads to.
+	jumped map[*Node]bool
+	lines  []plantUMLLine
+	depth  int
+}
+
+// plantUMLLoop is a loop being drawn: cont is where an iteration ends,
+// the header of a while or the condition of a repeat, and exit where the
+// loop leaves to. pdom are the post-dominators of its body, from cont.
+type plantUMLLoop struct {
+	cont, exit *Node
+	pdom       map[*Node]map[*Node]bool
+}
+
+// plantUMLLine is a line of the diagram. The connector of anchor is
+// written only when a path jumps to it.
+type plantUMLLine struct {
+	depth  int
+	text   string
+	anchor *Node
+}
+
+func newPlantUMLGraph(g *Graph) *plantUMLGraph {
+	p := &plantUMLGraph{
+		g:       g,
+		next:    map[*Node][]*Edge{},
+		prev:    map[*Node][]*Edge{},
+		throws:  map[*Node][]*Edge{},
+		emitted: map[*Node]bool{},
+		jumped:  map[*Node]bool{},
+	}
+	for _, e := range g.Edges {
+		if e.Kind == EdgeException {
+			p.throws[e.From] = append(p.throws[e.From], e)
+			continue
+		}
+		p.next[e.From] = append(p.next[e.From], e)
+		p.prev[e.To] = append(p.prev[e.To], e)
+	}
+	sinks := []*Node{g.End}
+	if g.End == nil || len(p.prev[g.End]) == 0 {
+		sinks = nil
+		for _, n := range g.Nodes {
+			if n.Kind == NodeReturn {
+				sinks = append(sinks, n)
+			}
+		}
+	}
+	p.pdom = p.postDominators(nil, sinks)
+	return p
+}
+
+// graph draws the graph from its start, then the nodes only connectors
+// or nothing lead to, such as catch clauses.
+func (p *plantUMLGraph) graph() {
+	if p.g.Start != nil {
+		p.region(p.g.Start, nil)
+	}
+	for _, n := range p.g.Nodes {
+		if !p.emitted[n] && !p.reused(n) {
+			p.region(n, nil)
+		}
+	}
+}
+
+func (p *plantUMLGraph) write(out *bufio.Writer) {
+	for _, l := range p.lines {
+		text := l.text
+		if l.anchor != nil {
+			if !p.jumped[l.anchor] {
+				continue
+			}
+			text = "(" + p.connector(l.anchor) + ")"
+		}
+		out.WriteString(strings.Repeat("  ", l.depth+1) + text + "\n")
+	}
+}
+
+func (p *plantUMLGraph) line(s string) {
+	p.lines = append(p.lines, plantUMLLine{depth: p.depth, text: s})
+}
+
+// reused tells whether n is drawn again wherever it is reached, as the
+// end and the uncaught exceptions are, rather than jumped to.
+func (p *plantUMLGraph) reused(n *Node) bool {
+	return n == p.g.End || n == p.g.Throws
+}
+
+// connector is the name of the circle standing for n: its label for goto
+// labels, its ID otherwise.
+func (p *plantUMLGraph) connector(n *Node) string {
+	if n.Kind == NodeLabel {
+		return plantUMLEscape(strings.TrimSuffix(n.Label, ":"))
+	}
+	return strconv.Itoa(n.ID)
+}
+
+// jump ends the path in the connector of n.
+func (p *plantUMLGraph) jump(n *Node) {
+	p.jumped[n] = true
+	p.line("(" + p.connector(n) + ")")
+	p.line("detach")
+}
+
+// region draws the path from n up to follow, leaving follow out.
+func (p *plantUMLGraph) region(n, follow *Node) {
+	for n != nil && n != follow {
+		if p.leave(n) {
+			return
+		}
+		if !p.reused(n) {
+			p.emitted[n] = true
+			p.lines = append(p.lines, plantUMLLine{depth: p.depth, anchor: n})
+		}
+		n = p.node(n)
+	}
+}
+
+// branch draws a region one level deeper.
+func (p *plantUMLGraph) branch(n, follow *Node) {
+	p.depth++
+	p.region(n, follow)
+	p.depth--
+}
+
+// leave ends the path reaching n when n is drawn elsewhere: with break
+// for the exit of the innermost loop, with a connector for the other
+// loops and the nodes drawn already.
+func (p *plantUMLGraph) leave(n *Node) bool {
+	if l := p.loop(); l != nil && n == l.exit {
+		p.line("break")
+		return true
+	}
+	if p.reused(n) {
+		return false
+	}
+	for _, l := range p.loops {
+		if n == l.exit || n == l.cont {
+			p.jump(n)
+			return true
+		}
+	}
+	if p.emitted[n] {
+		p.jump(n)
+		return true
+	}
+	return false
+}
+
+func (p *plantUMLGraph) loop() *plantUMLLoop {
+	if len(p.loops) == 0 {
+		return nil
+	}
+	return p.loops[len(p.loops)-1]
+}
+
+// node draws n and returns the node the path goes on with, nil when it
+// ends.
+func (p *plantUMLGraph) node(n *Node) *Node {
+	if n.Kind == NodeLoop && p.repeatOf(n) == nil {
+		return p.while(n)
+	}
+	if h := p.repeatAt(n); h != nil {
+		return p.repeat(n, h)
+	}
+	next := p.next[n]
+	if len(next) > 1 {
+		if n.Kind != NodeDecision && n.Kind != NodeLoop {
+			// the end of a finally block run by return statements
+			p.activity(n)
+			p.notes(n, "note right: ")
+		} else {
+			p.notes(n, "floating note right: ")
+		}
+		return p.decision(n, next)
+	}
+
+	p.activity(n)
+	// a throw statement goes nowhere but where its exceptions do
+	throws := p.throws[n]
+	throwing := len(next) == 0 && len(throws) != 0 && (n.Kind == NodeBlock || n.Kind == NodeThrow)
+	if throwing && len(throws) == 1 {
+		if to := throws[0].To; !p.reused(to) {
+			p.jump(to)
+		} else {
+			p.line("end")
+		}
+		return nil
+	}
+	p.notes(n, "note right: ")
+	switch {
+	case n.Kind == NodeEnd || n.Kind == NodeReturn && len(next) == 0:
+		p.line("stop")
+		return nil
+	case n.Kind == NodeExit || n.Kind == NodeThrow || throwing:
+		p.line("end")
+		return nil
+	case len(next) == 0:
+		p.line("detach")
+		return nil
+	}
+	if next[0].Label != "" {
+		p.line("-> " + plantUMLEscape(next[0].Label) + ";")
+	}
+	return next[0].To
+}
+
+// activity writes the box of n, nothing for the nodes with nothing to
+// show.
+func (p *plantUMLGraph) activity(n *Node) {
+	switch n.Kind {
+	case NodeStart:
+		p.line("start")
+	case NodeEnd:
+	case NodeMerge:
+		if n.Label != "" {
+			p.line(plantUMLBox(plantUMLText(n.Label)))
+		}
+	case NodeBlock:
+		lines := make([]string, 0, len(n.Stmts))
+		for _, s := range n.Stmts {
+			lines = append(lines, plantUMLText(s.Text))
+		}
+		p.line(plantUMLBox(strings.Join(lines, `\n`)))
+	case NodeUnparseable:
+		p.line("#mistyrose" + plantUMLBox(plantUMLText(n.Label)))
+	default:
+		p.line(plantUMLBox(plantUMLText(n.Label)))
+	}
+}
+
+// notes writes where the exceptions n may throw go, after prefix.
+func (p *plantUMLGraph) notes(n *Node, prefix string) {
+	var lines []string
+	for _, e := range p.throws[n] {
+		to := plantUMLEscape(e.To.Label)
+		if !p.reused(e.To) {
+			p.jumped[e.To] = true
+			to = "(" + p.connector(e.To) + ")"
+		}
+		lines = append(lines, plantUMLEscape(e.Label)+" -> "+to)
+	}
+	if len(lines) != 0 {
+		p.line(prefix + strings.Join(lines, `\n`))
+	}
+}
+
+// decision draws n as if or, with more than two branches, switch, and
+// returns where the branches meet.
+func (p *plantUMLGraph) decision(n *Node, next []*Edge) *Node {
+	follow := p.follow(n)
+	label := plantUMLText(n.Label)
+	if len(next) == 2 {
+		p.line("if (" + label + ") then" + plantUMLParen(next[0].Label))
+		p.branch(next[0].To, follow)
+		p.line("else" + plantUMLParen(next[1].Label))
+		p.branch(next[1].To, follow)
+		p.line("endif")
+		return follow
+	}
+	p.line("switch (" + label + ")")
+	for _, e := range next {
+		p.line("case" + plantUMLParen(e.Label))
+		p.branch(e.To, follow)
+	}
+	p.line("endswitch")
+	return follow
+}
+
+// follow returns where the branches leaving n meet: the node closest to
+// n every path from it to the end of the innermost loop, or of the graph,
+// goes through. The paths leaving the loop, or ending in a throw or an
+// exit, do not count, so the branch going on is drawn after the if.
+func (p *plantUMLGraph) follow(n *Node) *Node {
+	if l := p.loop(); l != nil {
+		return ipdom(l.pdom, n)
+	}
+	return ipdom(p.pdom, n)
+}
+
+// while draws the loop of header h and returns the node after it.
+func (p *plantUMLGraph) while(h *Node) *Node {
+	body := p.body(h)
+	in, out := p.loopEdges(h, body)
+	if in == nil {
+		return p.decision(h, p.next[h])
+	}
+	p.notes(h, "floating note right: ")
+	p.line("while (" + plantUMLText(h.Label) + ") is" + plantUMLParen(in.Label))
+	p.loops = append(p.loops, &plantUMLLoop{cont: h, exit: out.To, pdom: p.postDominators(body, []*Node{h})})
+	p.branch(in.To, h)
+	p.loops = p.loops[:len(p.loops)-1]
+	p.line("endwhile" + plantUMLParen(out.Label))
+	return out.To
+}
+
+// loopEdges returns the edge from header h into the loop body and the one
+// out of it, nil when h has not got two.
+func (p *plantUMLGraph) loopEdges(h *Node, body map[*Node]bool) (in, out *Edge) {
+	next := p.next[h]
+	if len(next) != 2 {
+		return nil, nil
+	}
+	in, out = next[0], next[1]
+	if body[in.To] == body[out.To] {
+		// a loop every iteration of which leaves it
+		if in.Label == "false" || in.Label == "done" {
+			in, out = out, in
+		}
+		return in, out
+	}
+	if !body[in.To] {
+		in, out = out, in
+	}
+	return in, out
+}
+
+// repeatOf returns the first node of the do-while loop h is the
+// condition of, nil when h is not one.
+func (p *plantUMLGraph) repeatOf(h *Node) *Node {
+	if h.Kind != NodeLoop {
+		return nil
+	}
+	for _, e := range p.next[h] {
+		if e.Kind == EdgeBack && e.To.Kind != NodeLoop {
+			return e.To
+		}
+	}
+	return nil
+}
+
+// repeatAt returns the condition of the do-while loop starting at n, nil
+// when none does.
+func (p *plantUMLGraph) repeatAt(n *Node) *Node {
+	for _, e := range p.prev[n] {
+		if e.Kind == EdgeBack && p.repeatOf(e.From) == n {
+			return e.From
+		}
+	}
+	return nil
+}
+
+// repeat draws the do-while loop from start to its condition h and
+// returns the node after it.
+func (p *plantUMLGraph) repeat(start, h *Node) *Node {
+	var again, out *Edge
+	for _, e := range p.next[h] {
+		if e.To == start && again == nil {
+			again = e
+		} else {
+			out = e
+		}
+	}
+	p.line("repeat")
+	p.depth++
+	p.activity(start)
+	if next := p.next[start]; len(next) == 1 {
+		l := &plantUMLLoop{cont: h, pdom: p.postDominators(p.body(start), []*Node{h})}
+		if out != nil {
+			l.exit = out.To
+		}
+		p.loops = append(p.loops, l)
+		p.region(next[0].To, h)
+		p.loops = p.loops[:len(p.loops)-1]
+	}
+	p.emitted[h] = true
+	p.lines = append(p.lines, plantUMLLine{depth: p.depth, anchor: h})
+	p.notes(h, "floating note right: ")
+	p.depth--
+	if out == nil {
+		p.line("repeat while (" + plantUMLText(h.Label) + ") is" + plantUMLParen(again.Label))
+		p.line("detach")
+		return nil
+	}
+	p.line("repeat while (" + plantUMLText(h.Label) + ") is" + plantUMLParen(again.Label) + " not" + plantUMLParen(out.Label))
+	return out.To
+}
+
+// body returns the nodes of the loop starting at h: h and the nodes from
+// which a path goes back to h without going through it.
+func (p *plantUMLGraph) body(h *Node) map[*Node]bool {
+	body := map[*Node]bool{h: true}
+	var todo []*Node
+	for _, e := range p.prev[h] {
+		if e.Kind == EdgeBack {
+			todo = append(todo, e.From)
+		}
+	}
+	for len(todo) != 0 {
+		n := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		if body[n] {
+			continue
+		}
+		body[n] = true
+		for _, e := range p.prev[n] {
+			todo = append(todo, e.From)
+		}
+	}
+	return body
+}
+
+// postDominators returns the nodes every path from each node of body, of
+// the whole graph when body is nil, to one of sinks goes through. A node
+// whose paths all leave body or end elsewhere gets nil. The sets start
+// from every node and narrow down until nothing changes; the nil key
+// stands for the sinks all together.
+func (p *plantUMLGraph) postDominators(body map[*Node]bool, sinks []*Node) map[*Node]map[*Node]bool {
+	pdom := map[*Node]map[*Node]bool{}
+	sink := map[*Node]bool{}
+	for _, n := range sinks {
+		sink[n] = true
+	}
+	for changed := true; changed; {
+		changed = false
+		for i := len(p.g.Nodes) - 1; i >= 0; i-- {
+			n := p.g.Nodes[i]
+			if body != nil && !body[n] {
+				continue
+			}
+			var set map[*Node]bool
+			if sink[n] {
+				set = map[*Node]bool{n: true, nil: true}
+			} else {
+				for _, e := range p.next[n] {
+					s := pdom[e.To]
+					switch {
+					case s == nil:
+					case set == nil:
+						set = map[*Node]bool{}
+						for d := range s {
+							set[d] = true
+						}
+					default:
+						for d := range set {
+							if !s[d] {
+								delete(set, d)
+							}
+						}
+					}
+				}
+				if set != nil {
+					set[n] = true
+				}
+			}
+			if !sameNodes(set, pdom[n]) {
+				pdom[n] = set
+				changed = true
+			}
+		}
+	}
+	return pdom
+}
+
+// ipdom returns the node of pdom closest to n, nil when there is none.
+func ipdom(pdom map[*Node]map[*Node]bool, n *Node) *Node {
+	var closest *Node
+	for d := range pdom[n] {
+		if d != n && d != nil && (closest == nil || len(pdom[d]) > len(pdom[closest])) {
+			closest = d
+		}
+	}
+	return closest
+}
+
+func sameNodes(a, b map[*Node]bool) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for n := range a {
+		if !b[n] {
+			return false
+		}
+	}
+	return true
+}
+
+// plantUMLText escapes s for an activity or condition, its lines joined
+// with \n.
+func plantUMLText(s string) string {
+	return strings.ReplaceAll(plantUMLEscape(s), "\n", `\n`)
+}
+
+// plantUMLBox returns the activity showing text, escaped already. A
+// character at its end that would close the activity, such as the ; of
+// a statement, gets a ~ before it.
+func plantUMLBox(text string) string {
+	if text != "" && strings.IndexByte(`;|]}>/`, text[len(text)-1]) >= 0 {
+		text = text[:len(text)-1] + "~" + text[len(text)-1:]
+	}
+	return ":" + text + ";"
+}
+
+// plantUMLParen returns the label of a branch in parentheses after a
+// space, nothing when it has none.
+func plantUMLParen(label string) string {
+	if label == "" {
+		return ""
+	}
+	return " (" + plantUMLText(label) + ")"
+}
+
+// plantUMLEscape escapes s so PlantUML shows it as it is. Backslashes
+// are doubled and creole markup, such as ** and -- or <b>, gets a ~
+// before it. The ~ itself is written as an HTML entity, as PHP uses it
+// on its own.
+func plantUMLEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		doubled := i > 0 && s[i-1] == c || i+1 < len(s) && s[i+1] == c
+		switch {
+		case c == '\\':
+			b.WriteString(`\\`)
+			continue
+		case c == '~':
+			b.WriteString("&#126;")
+			continue
+		case c == '&' && i+1 < len(s) && s[i+1] == '#':
+			b.WriteString("&#38;")
+			continue
+		case strings.IndexByte(`*/"-_`, c) >= 0 && doubled, c == '<' || c == '[':
+			b.WriteByte('~')
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
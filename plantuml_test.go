@@ -0,0 +1,103 @@
+package visualizephp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWritePlantUML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"break", `<?php
+while ($a) {
+    if ($b) { break; }
+    foo();
+}
+`, `
+  start
+  while ($a) is (true)
+    if ($b) then (true)
+      :break~;;
+      break
+    else (false)
+    endif
+    :foo()~;;
+  endwhile (false)
+  stop
+`},
+		{"break 2 and continue", `<?php
+foreach ($xs as $x) {
+    foreach ($x as $y) {
+        if ($y) { break 2; }
+        if (!$y) { continue; }
+        a();
+    }
+    b();
+}
+c();
+`, `
+  start
+  while (foreach $xs as $x) is (next)
+    while (foreach $x as $y) is (next)
+      if ($y) then (true)
+        :break 2~;;
+        (11)
+        detach
+      else (false)
+      endif
+      if (!$y) then (true)
+        :continue~;;
+      else (false)
+        :a()~;;
+      endif
+    endwhile (done)
+    :b()~;;
+  endwhile (done)
+  (11)
+  :c()~;;
+  stop
+`},
+		{"try", `<?php
+try {
+    risky();
+} catch (FooException $e) {
+    handle($e);
+}
+`, `
+  start
+  :risky()~;;
+  note right: exception -> throws\nexception -> (3)
+  stop
+  (3)
+  :catch (FooException $e);
+  :handle($e)~;;
+  stop
+`},
+		{"markup", `<?php
+$a--;
+echo "**bold** // <b>x</b> [[link]]";
+$b = ~$c;
+`, `
+  start
+  :$a~-~-~;;
+  :echo "~*~*bold~*~* ~/~/ ~<b>x~</b> ~[~[link]]"~;;
+  :$b = &#126;$c~;;
+  stop
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := WritePlantUML(&out, buildFlow(t, tt.src)); err != nil {
+				t.Fatal(err)
+			}
+			want := "@startuml\npartition \"{main}\" {" + tt.want + "}\n@enduml\n"
+			if got := out.String(); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
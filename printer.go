@@ -0,0 +1,536 @@
+package visualizephp
+
+import (
+	"strings"
+
+	"github.com/VKCOM/php-parser/pkg/ast"
+)
+
+// printPHP returns n, an expression or a simple statement of src, printed
+// as PHP on a single line with one space around binary operators and
+// after commas. Closure and class bodies are left out, strings whose
+// source spans lines get \n escapes, and heredocs and nowdocs are printed
+// as double quoted strings. Nodes the printer does not know are given as
+// their source with whitespace collapsed.
+func printPHP(src []byte, n ast.Vertex) string {
+	return printer{src}.node(n)
+}
+
+// printer prints the nodes of src.
+type printer struct {
+	src []byte
+}
+
+// binaryOp returns the operands and the operator of a binary or
+// assignment expression.
+func binaryOp(n ast.Vertex) (left, right ast.Vertex, op string, ok bool) {
+	switch n := n.(type) {
+	case *ast.ExprAssign:
+		return n.Var, n.Expr, "=", true
+	case *ast.ExprAssignReference:
+		return n.Var, n.Expr, "= &", true
+	case *ast.ExprAssignBitwiseAnd:
+		return n.Var, n.Expr, "&=", true
+	case *ast.ExprAssignBitwiseOr:
+		return n.Var, n.Expr, "|=", true
+	case *ast.ExprAssignBitwiseXor:
+		return n.Var, n.Expr, "^=", true
+	case *ast.ExprAssignCoalesce:
+		return n.Var, n.Expr, "??=", true
+	case *ast.ExprAssignConcat:
+		return n.Var, n.Expr, ".=", true
+	case *ast.ExprAssignDiv:
+		return n.Var, n.Expr, "/=", true
+	case *ast.ExprAssignMinus:
+		return n.Var, n.Expr, "-=", true
+	case *ast.ExprAssignMod:
+		return n.Var, n.Expr, "%=", true
+	case *ast.ExprAssignMul:
+		return n.Var, n.Expr, "*=", true
+	case *ast.ExprAssignPlus:
+		return n.Var, n.Expr, "+=", true
+	case *ast.ExprAssignPow:
+		return n.Var, n.Expr, "**=", true
+	case *ast.ExprAssignShiftLeft:
+		return n.Var, n.Expr, "<<=", true
+	case *ast.ExprAssignShiftRight:
+		return n.Var, n.Expr, ">>=", true
+	case *ast.ExprBinaryBitwiseAnd:
+		return n.Left, n.Right, "&", true
+	case *ast.ExprBinaryBitwiseOr:
+		return n.Left, n.Right, "|", true
+	case *ast.ExprBinaryBitwiseXor:
+		return n.Left, n.Right, "^", true
+	case *ast.ExprBinaryBooleanAnd:
+		return n.Left, n.Right, "&&", true
+	case *ast.ExprBinaryBooleanOr:
+		return n.Left, n.Right, "||", true
+	case *ast.ExprBinaryCoalesce:
+		return n.Left, n.Right, "??", true
+	case *ast.ExprBinaryConcat:
+		return n.Left, n.Right, ".", true
+	case *ast.ExprBinaryDiv:
+		return n.Left, n.Right, "/", true
+	case *ast.ExprBinaryEqual:
+		return n.Left, n.Right, "==", true
+	case *ast.ExprBinaryGreater:
+		return n.Left, n.Right, ">", true
+	case *ast.ExprBinaryGreaterOrEqual:
+		return n.Left, n.Right, ">=", true
+	case *ast.ExprBinaryIdentical:
+		return n.Left, n.Right, "===", true
+	case *ast.ExprBinaryLogicalAnd:
+		return n.Left, n.Right, "and", true
+	case *ast.ExprBinaryLogicalOr:
+		return n.Left, n.Right, "or", true
+	case *ast.ExprBinaryLogicalXor:
+		return n.Left, n.Right, "xor", true
+	case *ast.ExprBinaryMinus:
+		return n.Left, n.Right, "-", true
+	case *ast.ExprBinaryMod:
+		return n.Left, n.Right, "%", true
+	case *ast.ExprBinaryMul:
+		return n.Left, n.Right, "*", true
+	case *ast.ExprBinaryNotEqual:
+		return n.Left, n.Right, "!=", true
+	case *ast.ExprBinaryNotIdentical:
+		return n.Left, n.Right, "!==", true
+	case *ast.ExprBinaryPlus:
+		return n.Left, n.Right, "+", true
+	case *ast.ExprBinaryPow:
+		return n.Left, n.Right, "**", true
+	case *ast.ExprBinaryShiftLeft:
+		return n.Left, n.Right, "<<", true
+	case *ast.ExprBinaryShiftRight:
+		return n.Left, n.Right, ">>", true
+	case *ast.ExprBinarySmaller:
+		return n.Left, n.Right, "<", true
+	case *ast.ExprBinarySmallerOrEqual:
+		return n.Left, n.Right, "<=", true
+	case *ast.ExprBinarySpaceship:
+		return n.Left, n.Right, "<=>", true
+	}
+	return nil, nil, "", false
+}
+
+// unaryOp returns the operand of a prefix operator or cast and the
+// operator written before it.
+func unaryOp(n ast.Vertex) (expr ast.Vertex, op string, ok bool) {
+	switch n := n.(type) {
+	case *ast.ExprBitwiseNot:
+		return n.Expr, "~", true
+	case *ast.ExprBooleanNot:
+		return n.Expr, "!", true
+	case *ast.ExprUnaryMinus:
+		return n.Expr, "-", true
+	case *ast.ExprUnaryPlus:
+		return n.Expr, "+", true
+	case *ast.ExprPreDec:
+		return n.Var, "--", true
+	case *ast.ExprPreInc:
+		return n.Var, "++", true
+	case *ast.ExprErrorSuppress:
+		return n.Expr, "@", true
+	case *ast.ExprCastArray:
+		return n.Expr, "(array) ", true
+	case *ast.ExprCastBool:
+		return n.Expr, "(bool) ", true
+	case *ast.ExprCastDouble:
+		return n.Expr, "(float) ", true
+	case *ast.ExprCastInt:
+		return n.Expr, "(int) ", true
+	case *ast.ExprCastObject:
+		return n.Expr, "(object) ", true
+	case *ast.ExprCastString:
+		return n.Expr, "(string) ", true
+	case *ast.ExprCastUnset:
+		return n.Expr, "(unset) ", true
+	case *ast.ExprClone:
+		return n.Expr, "clone ", true
+	case *ast.ExprPrint:
+		return n.Expr, "print ", true
+	case *ast.ExprThrow:
+		return n.Expr, "throw ", true
+	case *ast.ExprYieldFrom:
+		return n.Expr, "yield from ", true
+	case *ast.ExprInclude:
+		return n.Expr, "include ", true
+	case *ast.ExprIncludeOnce:
+		return n.Expr, "include_once ", true
+	case *ast.ExprRequire:
+		return n.Expr, "require ", true
+	case *ast.ExprRequireOnce:
+		return n.Expr, "require_once ", true
+	}
+	return nil, "", false
+}
+
+func (p printer) node(n ast.Vertex) string {
+	if n == nil {
+		return ""
+	}
+	if left, right, op, ok := binaryOp(n); ok {
+		return p.node(left) + " " + op + " " + p.node(right)
+	}
+	if expr, op, ok := unaryOp(n); ok {
+		return op + p.node(expr)
+	}
+	switch n := n.(type) {
+	case *ast.StmtExpression:
+		return p.node(n.Expr) + ";"
+	case *ast.StmtEcho:
+		return "echo " + p.list(n.Exprs) + ";"
+	case *ast.StmtReturn:
+		return p.keyword("return", n.Expr) + ";"
+	case *ast.StmtThrow:
+		return "throw " + p.node(n.Expr) + ";"
+	case *ast.StmtBreak:
+		return p.keyword("break", n.Expr) + ";"
+	case *ast.StmtContinue:
+		return p.keyword("continue", n.Expr) + ";"
+	case *ast.StmtGoto:
+		return "goto " + p.node(n.Label) + ";"
+	case *ast.StmtGlobal:
+		return "global " + p.list(n.Vars) + ";"
+	case *ast.StmtStatic:
+		return "static " + p.list(n.Vars) + ";"
+	case *ast.StmtStaticVar:
+		return p.assigned(n.Var, n.Expr)
+	case *ast.StmtUnset:
+		return "unset(" + p.list(n.Vars) + ");"
+	case *ast.StmtConstList:
+		return "const " + p.list(n.Consts) + ";"
+	case *ast.StmtConstant:
+		return p.assigned(n.Name, n.Expr)
+	case *ast.StmtDeclare:
+		return "declare(" + p.list(n.Consts) + ");"
+	case *ast.StmtHaltCompiler:
+		return "__halt_compiler();"
+	case *ast.StmtInlineHtml:
+		return strings.Join(strings.Fields(string(n.Value)), " ")
+
+	case *ast.ScalarLnumber:
+		return string(n.Value)
+	case *ast.ScalarDnumber:
+		return string(n.Value)
+	case *ast.ScalarMagicConstant:
+		return string(n.Value)
+	case *ast.ScalarString:
+		return escapeNewlines(string(n.Value))
+	case *ast.ScalarEncapsed:
+		return `"` + p.parts(n.Parts) + `"`
+	case *ast.ScalarEncapsedStringPart:
+		return escapeNewlines(string(n.Value))
+	case *ast.ScalarEncapsedStringVar:
+		s := "${" + p.node(n.Name)
+		if n.Dim != nil {
+			s += "[" + p.node(n.Dim) + "]"
+		}
+		return s + "}"
+	case *ast.ScalarEncapsedStringBrackets:
+		return "{" + p.node(n.Var) + "}"
+	case *ast.ScalarHeredoc:
+		return p.heredoc(n)
+	case *ast.ExprShellExec:
+		return "`" + p.parts(n.Parts) + "`"
+
+	case *ast.Identifier:
+		return string(n.Value)
+	case *ast.Name, *ast.NameFullyQualified, *ast.NameRelative:
+		return nameString(n)
+	case *ast.Nullable:
+		return "?" + p.node(n.Expr)
+	case *ast.Union:
+		return p.join(n.Types, "|")
+	case *ast.ExprVariable:
+		if n.DollarTkn == nil {
+			return p.node(n.Name)
+		}
+		if _, ok := n.Name.(*ast.ExprVariable); ok {
+			return "$" + p.node(n.Name)
+		}
+		return "${" + p.node(n.Name) + "}"
+	case *ast.ExprConstFetch:
+		return p.node(n.Const)
+	case *ast.ExprBrackets:
+		return "(" + p.node(n.Expr) + ")"
+	case *ast.ExprPostDec:
+		return p.node(n.Var) + "--"
+	case *ast.ExprPostInc:
+		return p.node(n.Var) + "++"
+	case *ast.ExprTernary:
+		if n.IfTrue == nil {
+			return p.node(n.Cond) + " ?: " + p.node(n.IfFalse)
+		}
+		return p.node(n.Cond) + " ? " + p.node(n.IfTrue) + " : " + p.node(n.IfFalse)
+	case *ast.ExprInstanceOf:
+		return p.node(n.Expr) + " instanceof " + p.node(n.Class)
+
+	case *ast.ExprArray:
+		if n.ArrayTkn != nil {
+			return "array(" + p.list(n.Items) + ")"
+		}
+		return "[" + p.list(n.Items) + "]"
+	case *ast.ExprList:
+		if n.ListTkn != nil {
+			return "list(" + p.list(n.Items) + ")"
+		}
+		return "[" + p.list(n.Items) + "]"
+	case *ast.ExprArrayItem:
+		s := ""
+		if n.EllipsisTkn != nil {
+			s = "..."
+		}
+		if n.Key != nil {
+			s += p.node(n.Key) + " => "
+		}
+		if n.AmpersandTkn != nil {
+			s += "&"
+		}
+		return s + p.node(n.Val)
+	case *ast.ExprArrayDimFetch:
+		return p.node(n.Var) + "[" + p.node(n.Dim) + "]"
+	case *ast.ExprPropertyFetch:
+		return p.node(n.Var) + "->" + p.member(n.Prop, n.OpenCurlyBracketTkn != nil)
+	case *ast.ExprNullsafePropertyFetch:
+		return p.node(n.Var) + "?->" + p.member(n.Prop, n.OpenCurlyBracketTkn != nil)
+	case *ast.ExprStaticPropertyFetch:
+		return p.node(n.Class) + "::" + p.node(n.Prop)
+	case *ast.ExprClassConstFetch:
+		return p.node(n.Class) + "::" + p.node(n.Const)
+
+	case *ast.ExprFunctionCall:
+		return p.node(n.Function) + p.args(n.Args, n.EllipsisTkn != nil)
+	case *ast.ExprMethodCall:
+		return p.node(n.Var) + "->" + p.member(n.Method, n.OpenCurlyBracketTkn != nil) + p.args(n.Args, n.EllipsisTkn != nil)
+	case *ast.ExprNullsafeMethodCall:
+		return p.node(n.Var) + "?->" + p.member(n.Method, n.OpenCurlyBracketTkn != nil) + p.args(n.Args, n.EllipsisTkn != nil)
+	case *ast.ExprStaticCall:
+		return p.node(n.Class) + "::" + p.member(n.Call, n.OpenCurlyBracketTkn != nil) + p.args(n.Args, n.EllipsisTkn != nil)
+	case *ast.Argument:
+		s := ""
+		if n.Name != nil {
+			s = p.node(n.Name) + ": "
+		}
+		if n.VariadicTkn != nil {
+			s += "..."
+		}
+		if n.AmpersandTkn != nil {
+			s += "&"
+		}
+		return s + p.node(n.Expr)
+	case *ast.ExprNew:
+		if class, ok := n.Class.(*ast.StmtClass); ok {
+			return "new " + p.anonymousClass(class)
+		}
+		s := "new " + p.node(n.Class)
+		if n.OpenParenthesisTkn != nil {
+			s += "(" + p.list(n.Args) + ")"
+		}
+		return s
+
+	case *ast.ExprClosure:
+		s := p.function("function", n.StaticTkn != nil, n.AmpersandTkn != nil, n.Params)
+		if len(n.Uses) != 0 {
+			s += " use (" + p.list(n.Uses) + ")"
+		}
+		if n.ReturnType != nil {
+			s += ": " + p.node(n.ReturnType)
+		}
+		return s + " { … }"
+	case *ast.ExprClosureUse:
+		if n.AmpersandTkn != nil {
+			return "&" + p.node(n.Var)
+		}
+		return p.node(n.Var)
+	case *ast.ExprArrowFunction:
+		s := p.function("fn", n.StaticTkn != nil, n.AmpersandTkn != nil, n.Params)
+		if n.ReturnType != nil {
+			s += ": " + p.node(n.ReturnType)
+		}
+		return s + " => " + p.node(n.Expr)
+	case *ast.Parameter:
+		s := ""
+		if n.Type != nil {
+			s = p.node(n.Type) + " "
+		}
+		if n.AmpersandTkn != nil {
+			s += "&"
+		}
+		if n.VariadicTkn != nil {
+			s += "..."
+		}
+		s += p.node(n.Var)
+		if n.DefaultValue != nil {
+			s += " = " + p.node(n.DefaultValue)
+		}
+		return s
+	case *ast.ExprMatch:
+		return "match (" + p.node(n.Expr) + ") { " + p.list(n.Arms) + " }"
+	case *ast.MatchArm:
+		if n.DefaultTkn != nil {
+			return "default => " + p.node(n.ReturnExpr)
+		}
+		return p.list(n.Exprs) + " => " + p.node(n.ReturnExpr)
+
+	case *ast.ExprIsset:
+		return "isset(" + p.list(n.Vars) + ")"
+	case *ast.ExprEmpty:
+		return "empty(" + p.node(n.Expr) + ")"
+	case *ast.ExprEval:
+		return "eval(" + p.node(n.Expr) + ")"
+	case *ast.ExprExit:
+		s := strings.ToLower(string(n.ExitTkn.Value))
+		if n.OpenParenthesisTkn != nil {
+			s += "(" + p.node(n.Expr) + ")"
+		}
+		return s
+	case *ast.ExprYield:
+		if n.Key != nil {
+			return "yield " + p.node(n.Key) + " => " + p.node(n.Val)
+		}
+		return p.keyword("yield", n.Val)
+	}
+	return sourceText(p.src, n)
+}
+
+// list prints nodes separated by commas.
+func (p printer) list(nodes []ast.Vertex) string {
+	return p.join(nodes, ", ")
+}
+
+func (p printer) join(nodes []ast.Vertex, sep string) string {
+	printed := make([]string, len(nodes))
+	for i, n := range nodes {
+		printed[i] = p.node(n)
+	}
+	return strings.Join(printed, sep)
+}
+
+// keyword prints a keyword followed by an optional operand.
+func (p printer) keyword(keyword string, n ast.Vertex) string {
+	if n == nil {
+		return keyword
+	}
+	return keyword + " " + p.node(n)
+}
+
+// assigned prints a static variable or constant with its value.
+func (p printer) assigned(name, value ast.Vertex) string {
+	if value == nil {
+		return p.node(name)
+	}
+	return p.node(name) + " = " + p.node(value)
+}
+
+// member prints the name of a property or method, braced when it is
+// computed.
+func (p printer) member(n ast.Vertex, braced bool) string {
+	if braced {
+		return "{" + p.node(n) + "}"
+	}
+	return p.node(n)
+}
+
+// args prints the argument list of a call, (...) for a first class
+// callable.
+func (p printer) args(args []ast.Vertex, callable bool) string {
+	if callable {
+		return "(...)"
+	}
+	return "(" + p.list(args) + ")"
+}
+
+// function prints the head of a closure or arrow function up to its
+// parameters.
+func (p printer) function(keyword string, static, byRef bool, params []ast.Vertex) string {
+	if static {
+		keyword = "static " + keyword
+	}
+	if byRef {
+		keyword += " &"
+	}
+	return keyword + " (" + p.list(params) + ")"
+}
+
+func (p printer) anonymousClass(n *ast.StmtClass) string {
+	s := "class"
+	if n.OpenParenthesisTkn != nil {
+		s += "(" + p.list(n.Args) + ")"
+	}
+	if n.Extends != nil {
+		s += " extends " + p.node(n.Extends)
+	}
+	if len(n.Implements) != 0 {
+		s += " implements " + p.list(n.Implements)
+	}
+	return s + " { … }"
+}
+
+// parts prints the parts of an interpolated string, without quotes.
+func (p printer) parts(parts []ast.Vertex) string {
+	var s strings.Builder
+	for _, part := range parts {
+		s.WriteString(p.node(part))
+	}
+	return s.String()
+}
+
+// heredoc prints a heredoc or nowdoc as the double quoted string it
+// stands for, with the indentation of its closing marker taken off its
+// lines.
+func (p printer) heredoc(n *ast.ScalarHeredoc) string {
+	nowdoc := strings.Contains(string(n.OpenHeredocTkn.Value), "'")
+
+	// the text ends with a newline and the indentation of the marker
+	indent := ""
+	parts := n.Parts
+	var last string
+	if len(parts) != 0 {
+		if part, ok := parts[len(parts)-1].(*ast.ScalarEncapsedStringPart); ok {
+			last = string(part.Value)
+			if i := strings.LastIndex(last, "\n"); i >= 0 && strings.TrimLeft(last[i+1:], " \t") == "" {
+				indent = last[i+1:]
+				last = last[:i]
+			}
+			parts = parts[:len(parts)-1]
+		}
+	}
+
+	var s strings.Builder
+	lineStart := true
+	text := func(value string) {
+		lines := strings.Split(value, "\n")
+		for i, line := range lines {
+			if i != 0 || lineStart {
+				line = strings.TrimPrefix(line, indent)
+			}
+			if nowdoc {
+				line = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`).Replace(line)
+			} else {
+				line = strings.ReplaceAll(line, `"`, `\"`)
+			}
+			if i != 0 {
+				s.WriteString(`\n`)
+			}
+			s.WriteString(line)
+		}
+		lineStart = strings.HasSuffix(value, "\n")
+	}
+	for _, part := range parts {
+		if part, ok := part.(*ast.ScalarEncapsedStringPart); ok {
+			text(string(part.Value))
+			continue
+		}
+		s.WriteString(p.node(part))
+		lineStart = false
+	}
+	text(last)
+	return `"` + s.String() + `"`
+}
+
+// escapeNewlines writes the line breaks of a string literal as escapes,
+// keeping printed expressions on one line.
+func escapeNewlines(s string) string {
+	return strings.NewReplacer("\r\n", `\n`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
@@ -0,0 +1,27 @@
+package visualizephp
+
+import "testing"
+
+func TestPrintPHP(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`$var=='my name';`, `$var == 'my name';`},
+		{`$x=array(1,2)+[3=>4];`, `$x = array(1, 2) + [3 => 4];`},
+		{"$s=<<<EOT\na $b\nEOT;\n", `$s = "a $b";`},
+		{`$f=function($x)use($y){return $x;};`, `$f = function ($x) use ($y) { … };`},
+		{`echo $a?:$b,PHP_EOL;`, `echo $a ?: $b, PHP_EOL;`},
+		{`$o?->m(...$args);`, `$o?->m(...$args);`},
+	}
+	for _, tt := range tests {
+		src := []byte("<?php " + tt.src)
+		root, err := ParseFile(src, "8.1")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.src, err)
+		}
+		if got := printPHP(src, root.Stmts[0]); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package visualizephp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// phpExtensions are the extensions of the files LoadProject reads from a
+// directory.
+var phpExtensions = map[string]bool{
+	".php":   true,
+	".inc":   true,
+	".phtml": true,
+}
+
+// Project is a set of parsed PHP files.
+type Project struct {
+	// Dir is the directory file names are shown relative to.
+	Dir   string
+	Files []*SourceFile
+	// Autoload holds the autoload rules of the composer.json of the
+	// project, nil if it has none.
+	Autoload *Autoloader
+	// ExcludeVendor leaves the files under the vendor directory out of
+	// the diagrams, they are still read to resolve names.
+	ExcludeVendor bool
+}
+
+// LoadProject reads the PHP files under the directory at path, leaving
+// out hidden directories, or the file at path and the files it includes.
+// When a composer.json is found in the directory or above, the files
+// Composer autoloads the classes referred to from are read too; the
+// vendor directory is only read that way. phpVersion is the version given
+// to PHPVersion for each file.
+func LoadProject(path, phpVersion string) (*Project, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Project{Dir: path}
+	if !info.IsDir() {
+		p.Dir = filepath.Dir(path)
+	}
+	composer, err := findComposer(p.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if composer != "" {
+		if p.Autoload, err = LoadAutoloader(composer, phpVersion); err != nil {
+			return nil, fmt.Errorf("%s: %v", composer, err)
+		}
+		// files are named from the root of the project
+		if !info.IsDir() {
+			p.Dir = filepath.Dir(composer)
+		}
+	}
+
+	b := newIncludeBuilder(phpVersion)
+	if !info.IsDir() {
+		b.visit(b.file(path))
+	} else {
+		err = filepath.Walk(path, func(f string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				hidden := f != path && strings.HasPrefix(info.Name(), ".")
+				if hidden || p.Autoload != nil && f == p.Autoload.VendorDir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if phpExtensions[filepath.Ext(f)] {
+				b.file(f)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.Autoload != nil {
+		load := func(path string) {
+			if _, ok := b.files[path]; !ok {
+				b.visit(b.file(path))
+			}
+		}
+		// Composer includes these on every request, for the functions
+		// they declare
+		for _, f := range p.Autoload.Files {
+			load(f)
+		}
+		// the files appended are looked at in turn
+		for i := 0; i < len(b.graph.Files); i++ {
+			f := b.graph.Files[i]
+			if f.Root == nil {
+				continue
+			}
+			for _, class := range newFileDecls(f).referencedClasses() {
+				if path := p.Autoload.Lookup(class); path != "" {
+					load(path)
+				}
+			}
+		}
+	}
+	p.Files = b.graph.Files
+	return p, nil
+}
+
+// drawn tells whether f is to be drawn, not being left out as part of the
+// vendor directory.
+func (p *Project) drawn(f *SourceFile) bool {
+	if !p.ExcludeVendor {
+		return true
+	}
+	vendor := filepath.Join(p.Dir, "vendor")
+	if p.Autoload != nil {
+		vendor = p.Autoload.VendorDir
+	}
+	rel, err := filepath.Rel(vendor, f.Path)
+	return err != nil || strings.HasPrefix(rel, "..")
+}
+
+// relName returns the path of f relative to the project directory.
+func (p *Project) relName(f *SourceFile) string {
+	if rel, err := filepath.Rel(p.Dir, f.Path); err == nil {
+		return rel
+	}
+	return f.Path
+}
@@ -0,0 +1,1109 @@
+// Package visualizephp turns PHP source into flowcharts and diagrams.
+// BuildFlow, BuildIncludeGraph, BuildCallGraph and BuildClassDiagram build
+// them and a Renderer, found by format with LookupRenderer, draws them.
+// The visualize command in cmd/visualizePhp is its command line front
+// end.
+package visualizephp
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/VKCOM/php-parser/pkg/ast"
+	"github.com/VKCOM/php-parser/pkg/conf"
+	phperrors "github.com/VKCOM/php-parser/pkg/errors"
+	"github.com/VKCOM/php-parser/pkg/parser"
+	"github.com/VKCOM/php-parser/pkg/position"
+	"github.com/VKCOM/php-parser/pkg/visitor"
+	"github.com/VKCOM/php-parser/pkg/visitor/traverser"
+)
+
+// maxRecoveries bounds how many lines ParseFile blanks out when the
+// parser gives up on a file.
+const maxRecoveries = 20
+
+// ParseFile parses code written for the given PHP version, such as "7.4".
+// See PHPVersion to pick it. When the code has syntax errors, ParseFile
+// returns the tree the parser recovered along with the errors as
+// ParseErrors. Where the parser gives up on the whole file, or on the
+// rest of it, the line it stopped at is blanked out, or a block left open
+// at the end closed, and the file parsed again.
+//
+// from -> https://github.com/VKCOM/noverify/blob/master/src/php/parseutil/parseutil.go
+func ParseFile(code []byte, phpVersion string) (*ast.Root, error) {
+	v, err := parserVersion(phpVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// skipped are the errors at the lines blanked out
+	var skipped ParseErrors
+	patched := code
+	for attempt := 0; ; attempt++ {
+		var parserErrors ParseErrors
+		rootNode, err := parser.Parse(patched, conf.Config{
+			Version: v,
+			ErrorHandlerFunc: func(e *phperrors.Error) {
+				parserErrors = append(parserErrors, newParseError(code, e))
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if rootNode != nil && (!truncated(parserErrors) || attempt == maxRecoveries) {
+			parserErrors = append(skipped, parserErrors...)
+			if len(parserErrors) != 0 {
+				// in source order, the ones at the end without a line last
+				sort.SliceStable(parserErrors, func(i, j int) bool {
+					a, b := parserErrors[i].Line, parserErrors[j].Line
+					return a != 0 && (b == 0 || a < b)
+				})
+				return rootNode.(*ast.Root), parserErrors
+			}
+			return rootNode.(*ast.Root), nil
+		}
+		if len(parserErrors) == 0 || attempt == maxRecoveries {
+			if parserErrors = append(skipped, parserErrors...); len(parserErrors) != 0 {
+				return nil, parserErrors
+			}
+			return nil, errors.New("file has incorrect syntax and cannot be parsed")
+		}
+
+		last := lastPlaced(parserErrors)
+		skipped = append(skipped, last)
+		patched = skipLine(patched, last.Pos)
+	}
+}
+
+// truncated tells whether the parser gave up on the rest of the file
+// after an error, such as the (unset) cast PHP 8 removed: it then reports
+// reaching the end, an error without a position, on top of the ones it
+// placed.
+func truncated(errs ParseErrors) bool {
+	var end, placed bool
+	for _, e := range errs {
+		if e.Pos == nil {
+			end = true
+		} else {
+			placed = true
+		}
+	}
+	return end && placed
+}
+
+// lastPlaced returns the last of errs with a position, the last of errs
+// when none has one.
+func lastPlaced(errs ParseErrors) *ParseError {
+	for i := len(errs) - 1; i >= 0; i-- {
+		if errs[i].Pos != nil {
+			return errs[i]
+		}
+	}
+	return errs[len(errs)-1]
+}
+
+// skipLine returns a copy of code with the line at pos replaced by
+// spaces, keeping the positions of the rest, or with a closing brace
+// added when pos is nil, the parser having reached the end.
+func skipLine(code []byte, pos *position.Position) []byte {
+	if pos == nil || pos.StartPos >= len(code) {
+		return append(append([]byte{}, code...), "\n}"...)
+	}
+	patched := append([]byte{}, code...)
+	for i := pos.StartPos; i >= 0 && patched[i] != '\n'; i-- {
+		patched[i] = ' '
+	}
+	for i := pos.StartPos; i < len(patched) && patched[i] != '\n'; i++ {
+		patched[i] = ' '
+	}
+	return patched
+}
+
+type AstReader struct {
+	flow     *FlowBuilder
+	unparsed *unparsed
+	inliner  *inliner
+	expander *callExpander
+	// decls are the declarations of the file being read, to qualify the
+	// names of its functions and resolve the calls to expand.
+	decls *fileDecls
+}
+
+// NewAstReader returns a reader building the flow of src. errs are the
+// syntax errors ParseFile found in src, drawn as unparseable nodes where
+// the parser skipped code.
+func NewAstReader(src []byte, errs ParseErrors) *AstReader {
+	return &AstReader{
+		flow:     NewFlowBuilder(src),
+		unparsed: newUnparsed(errs),
+	}
+}
+
+// InlineIncludes makes the reader inline the files included by the
+// include and require statements of file, the file being read, where
+// their paths can be worked out. include_once and require_once are left
+// alone when the file was included on every path reaching them. phpVersion
+// is the version given to PHPVersion for the included files.
+func (a *AstReader) InlineIncludes(file, phpVersion string) error {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	a.inliner = newInliner(path, phpVersion)
+	return nil
+}
+
+// FormatLabels makes the reader cut and wrap the labels of the flow as f
+// says.
+func (a *AstReader) FormatLabels(f LabelFormat) {
+	a.flow.labelFormat = f
+}
+
+// SetFile gives the path of the file being read. The files of the
+// locations of the nodes are named relative to its directory.
+func (a *AstReader) SetFile(path string) {
+	a.flow.file = filepath.Base(path)
+	if abs, err := filepath.Abs(path); err == nil {
+		a.flow.dir = filepath.Dir(abs)
+	}
+}
+
+// newChild returns a reader for a child node sharing the same flow builder.
+func (a *AstReader) newChild() *AstReader {
+	return &AstReader{
+		flow:     a.flow,
+		unparsed: a.unparsed,
+		inliner:  a.inliner,
+		expander: a.expander,
+		decls:    a.decls,
+	}
+}
+
+// visitStmts walks a statement list, keeping a child reader per statement.
+func (a *AstReader) visitStmts(stmts []ast.Vertex) {
+	for _, stmt := range stmts {
+		if stmt == nil {
+			continue
+		}
+		stmt.Accept(a.newChild())
+	}
+}
+
+// visitStmt walks the body of a control structure, which is either a
+// braced statement list or a single statement.
+func (a *AstReader) visitStmt(stmt ast.Vertex) {
+	if stmt == nil {
+		return
+	}
+	a.visitStmts([]ast.Vertex{stmt})
+}
+
+// statement adds a straight-line statement to the flow, preceded by the
+// decisions of the match expressions it contains. Throw expressions and
+// calls in the statement get exceptional edges.
+func (a *AstReader) statement(n ast.Vertex) {
+	a.expandCalls(n)
+	finder := a.expand(n)
+	a.flow.Statement(n)
+	a.raise(finder)
+}
+
+// terminal ends the path with a node of the given kind showing label, the
+// text of n when empty.
+func (a *AstReader) terminal(n ast.Vertex, kind NodeKind, label string) {
+	if label == "" {
+		label = a.flow.text(n)
+	}
+	a.expandCalls(n)
+	finder := a.expand(n)
+	a.flow.Terminal(kind, label, n.GetPosition())
+	a.raise(finder)
+	if kind == NodeReturn {
+		a.flow.Leave()
+	} else {
+		a.flow.Unreachable()
+	}
+}
+
+// unparseable adds a node for each syntax error within pos, or for each
+// one left when pos is nil.
+func (a *AstReader) unparseable(pos *position.Position) {
+	for _, e := range a.unparsed.take(pos) {
+		a.flow.Unparseable(e)
+	}
+}
+
+// expand adds the decisions of the match expressions in n and returns
+// what else n holds that changes the flow.
+func (a *AstReader) expand(n ast.Vertex) *exprFinder {
+	finder := &exprFinder{}
+	traverser.NewTraverser(finder).Traverse(n)
+	for _, match := range finder.outermost() {
+		match.Accept(a.newChild())
+	}
+	return finder
+}
+
+// raise adds the exceptional edges for what the finder found.
+func (a *AstReader) raise(finder *exprFinder) {
+	for _, thrown := range finder.throws {
+		a.flow.Raise(thrownClass(thrown))
+	}
+	if finder.mayThrow() {
+		a.flow.MayThrow()
+	}
+}
+
+// exprFinder collects the expressions of a subtree that take part in the
+// control flow of the statement holding them.
+type exprFinder struct {
+	visitor.Null
+	matches []*ast.ExprMatch
+	// throws are the thrown expressions.
+	throws []ast.Vertex
+	news   []*ast.ExprNew
+	calls  int
+	// apart are the closures and the bodies of anonymous classes, whose
+	// code does not run with the statement. The traverser meets them
+	// before what they hold.
+	apart []ast.Vertex
+}
+
+// isApart tells whether n is written in a closure or anonymous class.
+func (f *exprFinder) isApart(n ast.Vertex) bool {
+	for _, body := range f.apart {
+		if contains(body.GetPosition(), n.GetPosition()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *exprFinder) ExprClosure(n *ast.ExprClosure) {
+	f.apart = append(f.apart, n)
+}
+
+func (f *exprFinder) ExprArrowFunction(n *ast.ExprArrowFunction) {
+	f.apart = append(f.apart, n)
+}
+
+func (f *exprFinder) StmtClass(n *ast.StmtClass) {
+	f.apart = append(f.apart, n.Stmts...)
+}
+
+func (f *exprFinder) ExprMatch(n *ast.ExprMatch) {
+	if !f.isApart(n) {
+		f.matches = append(f.matches, n)
+	}
+}
+
+func (f *exprFinder) ExprThrow(n *ast.ExprThrow) {
+	if !f.isApart(n) {
+		f.throws = append(f.throws, n.Expr)
+	}
+}
+
+func (f *exprFinder) ExprNew(n *ast.ExprNew) {
+	if !f.isApart(n) {
+		f.news = append(f.news, n)
+	}
+}
+
+func (f *exprFinder) StmtThrow(n *ast.StmtThrow) {
+	if !f.isApart(n) {
+		f.throws = append(f.throws, n.Expr)
+	}
+}
+
+func (f *exprFinder) ExprFunctionCall(n *ast.ExprFunctionCall) {
+	f.call(n)
+}
+
+func (f *exprFinder) ExprMethodCall(n *ast.ExprMethodCall) {
+	f.call(n)
+}
+
+func (f *exprFinder) ExprNullsafeMethodCall(n *ast.ExprNullsafeMethodCall) {
+	f.call(n)
+}
+
+func (f *exprFinder) ExprStaticCall(n *ast.ExprStaticCall) {
+	f.call(n)
+}
+
+func (f *exprFinder) call(n ast.Vertex) {
+	if !f.isApart(n) {
+		f.calls++
+	}
+}
+
+// mayThrow tells whether a call or an object creation other than the one
+// of a thrown exception may throw.
+func (f *exprFinder) mayThrow() bool {
+	if f.calls != 0 {
+		return true
+	}
+	for _, n := range f.news {
+		thrown := false
+		for _, expr := range f.throws {
+			if expr == n {
+				thrown = true
+			}
+		}
+		if !thrown {
+			return true
+		}
+	}
+	return false
+}
+
+// thrownClass returns the class of a thrown exception when it is created
+// in the throw statement.
+func thrownClass(expr ast.Vertex) string {
+	if n, ok := expr.(*ast.ExprNew); ok {
+		switch class := n.Class.(type) {
+		case *ast.Name, *ast.NameFullyQualified, *ast.NameRelative:
+			return nameString(class)
+		}
+	}
+	return ""
+}
+
+// nameString joins the parts of a class or function name.
+func nameString(n ast.Vertex) string {
+	var parts []ast.Vertex
+	prefix := ""
+	switch n := n.(type) {
+	case *ast.Name:
+		parts = n.Parts
+	case *ast.NameFullyQualified:
+		parts = n.Parts
+		prefix = "\\"
+	case *ast.NameRelative:
+		parts = n.Parts
+		prefix = "namespace\\"
+	case *ast.Identifier:
+		return string(n.Value)
+	}
+	names := make([]string, 0, len(parts))
+	for _, part := range parts {
+		names = append(names, string(part.(*ast.NamePart).Value))
+	}
+	return prefix + strings.Join(names, "\\")
+}
+
+// outermost drops the matches nested in the arms of another one, they are
+// found again when the arm is added.
+func (f *exprFinder) outermost() []*ast.ExprMatch {
+	var result []*ast.ExprMatch
+	for _, match := range f.matches {
+		if len(result) != 0 {
+			outer := result[len(result)-1].Position
+			if match.Position.StartPos >= outer.StartPos && match.Position.EndPos <= outer.EndPos {
+				continue
+			}
+		}
+		result = append(result, match)
+	}
+	return result
+}
+
+func (a *AstReader) Flow() *Flow {
+	return a.flow.Flow()
+}
+
+func (a *AstReader) Root(n *ast.Root) {
+	a.decls = newFileDecls(&SourceFile{Path: a.flow.file, Src: a.flow.src, Root: n})
+	if a.expander != nil {
+		a.expander.add(a.decls)
+	}
+
+	saved := a.flow.BeginGraph("{main}", n.Position)
+	a.visitStmts(n.Stmts)
+	// errors outside of any statement, at the end of the file for instance
+	a.unparseable(nil)
+	a.nested(n.Stmts)
+	a.flow.EndGraph(saved)
+}
+func (a *AstReader) Nullable(n *ast.Nullable)     {}
+func (a *AstReader) Parameter(n *ast.Parameter)   {}
+func (a *AstReader) Identifier(n *ast.Identifier) {}
+func (a *AstReader) Argument(n *ast.Argument)     {}
+
+// MatchArm is entered through the edge ExprMatch follows for it. The arm
+// evaluates its return expression and leaves the match, there is no
+// fallthrough.
+func (a *AstReader) MatchArm(n *ast.MatchArm) {
+	a.statement(n.ReturnExpr)
+	if _, ok := n.ReturnExpr.(*ast.ExprThrow); ok {
+		n.ReturnExpr.Accept(a)
+	}
+}
+func (a *AstReader) Union(n *ast.Union)                   {}
+func (a *AstReader) Attribute(n *ast.Attribute)           {}
+func (a *AstReader) AttributeGroup(n *ast.AttributeGroup) {}
+
+func (a *AstReader) StmtBreak(n *ast.StmtBreak) {
+	a.statement(n)
+	a.flow.Break(loopLevel(n.Expr))
+}
+func (a *AstReader) StmtCase(n *ast.StmtCase) {
+	a.flow.Case(n.Cond)
+	a.visitStmts(n.Stmts)
+	a.flow.EndCase(len(n.Stmts) == 0)
+}
+func (a *AstReader) StmtCatch(n *ast.StmtCatch) {
+	types := make([]string, 0, len(n.Types))
+	for _, t := range n.Types {
+		types = append(types, a.flow.text(t))
+	}
+	label := "catch (" + strings.Join(types, " | ")
+	if n.Var != nil {
+		label += " " + a.flow.text(n.Var)
+	}
+	a.flow.BeginCatch(label+")", n.Position)
+	a.visitStmts(n.Stmts)
+	a.flow.EndCatch()
+}
+
+// StmtEnum, StmtClass, StmtInterface and StmtTrait do not take part in
+// the flow, their methods get graphs of their own.
+func (a *AstReader) StmtEnum(n *ast.StmtEnum) {
+	a.visitStmts(n.Stmts)
+}
+func (a *AstReader) EnumCase(n *ast.EnumCase) {}
+func (a *AstReader) StmtClass(n *ast.StmtClass) {
+	a.visitStmts(n.Stmts)
+}
+func (a *AstReader) StmtClassConstList(n *ast.StmtClassConstList) {}
+
+// StmtClassMethod draws the body of a method as a graph named
+// Class::method, like StmtFunction. Abstract methods have no body.
+func (a *AstReader) StmtClassMethod(n *ast.StmtClassMethod) {
+	body, ok := n.Stmt.(*ast.StmtStmtList)
+	if !ok || a.flow.InCall() || !a.inliner.declare(n.Position) {
+		return
+	}
+	saved := a.flow.BeginGraph(a.decls.methodName(n), n.Position)
+	a.flow.Signature(newParams(a.flow.src, n.Params), typeText(a.flow.src, n.ReturnType))
+	a.visitStmts(body.Stmts)
+	a.unparseable(n.Position)
+	a.nested(body.Stmts)
+	a.flow.EndGraph(saved)
+}
+func (a *AstReader) StmtConstList(n *ast.StmtConstList) {
+	a.statement(n)
+}
+func (a *AstReader) StmtConstant(n *ast.StmtConstant) {}
+func (a *AstReader) StmtContinue(n *ast.StmtContinue) {
+	a.statement(n)
+	a.flow.Continue(loopLevel(n.Expr))
+}
+func (a *AstReader) StmtDeclare(n *ast.StmtDeclare) {
+	a.statement(n)
+}
+func (a *AstReader) StmtDefault(n *ast.StmtDefault) {
+	a.flow.Default(n.Position)
+	a.visitStmts(n.Stmts)
+	a.flow.EndCase(len(n.Stmts) == 0)
+}
+
+// StmtDo runs the body once before the condition decides whether to go
+// back to its start.
+func (a *AstReader) StmtDo(n *ast.StmtDo) {
+	a.flow.BeginLoop()
+	entry := a.flow.Join()
+	a.visitStmt(n.Stmt)
+	a.flow.JoinContinues()
+
+	a.expandCalls(n.Cond)
+	header := a.flow.LoopHeader(a.flow.text(n.Cond), n.Cond.GetPosition())
+	a.flow.Follow(header, "true")
+	a.flow.Repeat(entry)
+	a.flow.Follow(header, "false")
+	a.flow.EndLoop()
+}
+func (a *AstReader) StmtEcho(n *ast.StmtEcho) {
+	a.statement(n)
+}
+
+// StmtElse follows the false exit left open by the last condition of the
+// chain.
+func (a *AstReader) StmtElse(n *ast.StmtElse) {
+	a.visitStmt(n.Stmt)
+	a.flow.EndBranch()
+}
+
+// StmtElseIf is reached through the false exit of the previous condition
+// and leaves its own false exit open for the rest of the chain.
+func (a *AstReader) StmtElseIf(n *ast.StmtElseIf) {
+	a.expandCalls(n.Cond)
+	decision := a.flow.Decision(n.Cond)
+	a.flow.Follow(decision, "true")
+	a.visitStmt(n.Stmt)
+	a.flow.EndBranch()
+	a.flow.Follow(decision, "false")
+}
+func (a *AstReader) StmtExpression(n *ast.StmtExpression) {
+	switch expr := n.Expr.(type) {
+	case *ast.ExprExit:
+		expr.Accept(a)
+	case *ast.ExprBinaryLogicalOr:
+		a.orExit(n, expr.Left, expr.Right)
+	case *ast.ExprBinaryBooleanOr:
+		a.orExit(n, expr.Left, expr.Right)
+	case *ast.ExprInclude, *ast.ExprIncludeOnce, *ast.ExprRequire, *ast.ExprRequireOnce:
+		a.statement(n)
+		expr.Accept(a)
+	default:
+		a.statement(n)
+		if _, ok := n.Expr.(*ast.ExprThrow); ok {
+			n.Expr.Accept(a)
+		}
+	}
+}
+
+// include inlines the file an include statement includes, when asked to
+// and the file is known. It is not inlined again into itself.
+func (a *AstReader) include(expr ast.Vertex, once bool) {
+	in := a.inliner
+	if in == nil {
+		return
+	}
+	path, ok := includePath(expr, in.file)
+	if !ok || in.active[path] || once && a.flow.Included(path) {
+		return
+	}
+	f := in.files.file(path)
+	if f.Root == nil {
+		return
+	}
+
+	saved := a.flow.BeginInclude(path, f.Src)
+	file := in.file
+	in.file, in.active[path] = path, true
+	child := a.newChild()
+	child.unparsed = newUnparsed(f.Errors)
+	child.decls = newFileDecls(f)
+	if a.expander != nil {
+		a.expander.add(child.decls)
+	}
+	child.visitStmts(f.Root.Stmts)
+	child.unparseable(nil)
+	child.nested(f.Root.Stmts)
+	in.file, in.active[path] = file, false
+	a.flow.EndInclude(saved)
+}
+
+// orExit turns the "$f = fopen($path) or die();" idiom into a decision
+// that exits when left is false.
+func (a *AstReader) orExit(n, left, right ast.Vertex) {
+	exit, ok := right.(*ast.ExprExit)
+	if !ok {
+		a.statement(n)
+		return
+	}
+	decision := a.flow.Decision(left)
+	a.flow.Follow(decision, "false")
+	exit.Accept(a)
+	a.flow.Follow(decision, "true")
+}
+func (a *AstReader) StmtFinally(n *ast.StmtFinally) {
+	a.flow.BeginFinally(n.Position)
+	a.visitStmts(n.Stmts)
+}
+
+// StmtFor runs the init expressions once, then loops through the
+// condition, the body and the step expressions. A for without condition
+// only ends through break.
+func (a *AstReader) StmtFor(n *ast.StmtFor) {
+	for _, init := range n.Init {
+		a.statement(init)
+	}
+
+	a.flow.BeginLoop()
+	var header, entry *Node
+	if len(n.Cond) == 0 {
+		header = a.flow.Join()
+		entry = header
+	} else {
+		conds := make([]string, 0, len(n.Cond))
+		for _, cond := range n.Cond {
+			conds = append(conds, a.flow.text(cond))
+		}
+		entry = a.conditionCalls(n.Cond...)
+		header = a.flow.LoopHeader(strings.Join(conds, ", "), n.Cond[0].GetPosition())
+		if entry == nil {
+			entry = header
+		}
+		a.flow.Follow(header, "true")
+	}
+
+	a.visitStmt(n.Stmt)
+	a.flow.JoinContinues()
+	for _, step := range n.Loop {
+		a.statement(step)
+	}
+	a.flow.Repeat(entry)
+
+	if len(n.Cond) != 0 {
+		a.flow.Follow(header, "false")
+	}
+	a.flow.EndLoop()
+}
+
+// StmtForeach shows the iterated expression and its key and value
+// bindings on the loop header.
+func (a *AstReader) StmtForeach(n *ast.StmtForeach) {
+	label := a.flow.text(n.Expr) + " as "
+	if n.Key != nil {
+		label += a.flow.text(n.Key) + " => "
+	}
+	if n.AmpersandTkn != nil {
+		label += "&"
+	}
+	label += a.flow.text(n.Var)
+
+	// the expression is evaluated once, before the first iteration
+	a.expandCalls(n.Expr)
+	a.flow.BeginLoop()
+	header := a.flow.LoopHeader("foreach "+label, n.Position)
+	a.flow.Follow(header, "next")
+	a.visitStmt(n.Stmt)
+	a.flow.JoinContinues()
+	a.flow.Repeat(header)
+
+	a.flow.Follow(header, "done")
+	a.flow.EndLoop()
+}
+func (a *AstReader) StmtFunction(n *ast.StmtFunction) {
+	// the functions declared by the body of an expanded call have their
+	// graph already
+	if n == nil || a.flow.InCall() || !a.inliner.declare(n.Position) {
+		return
+	}
+	// the body is a graph of its own, the declaration does not take part
+	// in the flow of the enclosing statements
+	name := a.decls.qualify(nameString(n.Name), n.Position)
+	saved := a.flow.BeginGraph(name, n.Position)
+	a.flow.Signature(newParams(a.flow.src, n.Params), typeText(a.flow.src, n.ReturnType))
+	a.visitStmts(n.Stmts)
+	// the parser drops the whole body of a function it cannot read
+	a.unparseable(n.Position)
+	a.nested(n.Stmts)
+	a.flow.EndGraph(saved)
+}
+
+// nested draws the closures, arrow functions and anonymous classes of
+// stmts, the body of the graph being built, in graphs of their own.
+func (a *AstReader) nested(stmts []ast.Vertex) {
+	finder := &nestedFinder{}
+	t := traverser.NewTraverser(finder)
+	for _, stmt := range stmts {
+		t.Traverse(stmt)
+	}
+	for _, n := range finder.found {
+		n.Accept(a.newChild())
+	}
+}
+
+// nestedFinder collects the closures, arrow functions and anonymous
+// classes of a statement list but those in one another or in the
+// functions and classes it declares, which are found with their body.
+type nestedFinder struct {
+	visitor.Null
+	found []ast.Vertex
+	// skipped are the declarations met, the traverser meets them before
+	// what they hold.
+	skipped []ast.Vertex
+}
+
+func (f *nestedFinder) skip(n ast.Vertex, found bool) {
+	for _, s := range f.skipped {
+		if contains(s.GetPosition(), n.GetPosition()) {
+			return
+		}
+	}
+	if found {
+		f.found = append(f.found, n)
+	}
+	f.skipped = append(f.skipped, n)
+}
+
+func (f *nestedFinder) ExprClosure(n *ast.ExprClosure) {
+	f.skip(n, true)
+}
+
+func (f *nestedFinder) ExprArrowFunction(n *ast.ExprArrowFunction) {
+	f.skip(n, true)
+}
+
+func (f *nestedFinder) StmtClass(n *ast.StmtClass) {
+	f.skip(n, n.Name == nil)
+}
+
+func (f *nestedFinder) StmtFunction(n *ast.StmtFunction) {
+	f.skip(n, false)
+}
+
+func (f *nestedFinder) StmtInterface(n *ast.StmtInterface) {
+	f.skip(n, false)
+}
+
+func (f *nestedFinder) StmtTrait(n *ast.StmtTrait) {
+	f.skip(n, false)
+}
+
+func (f *nestedFinder) StmtEnum(n *ast.StmtEnum) {
+	f.skip(n, false)
+}
+
+func (a *AstReader) StmtGlobal(n *ast.StmtGlobal) {
+	a.statement(n)
+}
+func (a *AstReader) StmtGoto(n *ast.StmtGoto) {
+	a.statement(n)
+	a.flow.Goto(nameString(n.Label))
+}
+func (a *AstReader) StmtHaltCompiler(n *ast.StmtHaltCompiler) {
+	a.statement(n)
+}
+
+// StmtIf builds a decision per condition of the if/elseif/else chain and
+// joins the branches that fall through in a single merge node.
+func (a *AstReader) StmtIf(n *ast.StmtIf) {
+	saved := a.flow.BeginChain()
+
+	a.expandCalls(n.Cond)
+	decision := a.flow.Decision(n.Cond)
+	a.flow.Follow(decision, "true")
+	a.visitStmt(n.Stmt)
+	a.flow.EndBranch()
+	a.flow.Follow(decision, "false")
+
+	for _, elseIf := range n.ElseIf {
+		a.visitStmt(elseIf)
+	}
+	a.visitStmt(n.Else)
+
+	a.flow.EndChain(saved)
+}
+func (a *AstReader) StmtInlineHtml(n *ast.StmtInlineHtml) {
+	a.statement(n)
+}
+func (a *AstReader) StmtInterface(n *ast.StmtInterface) {
+	a.visitStmts(n.Stmts)
+}
+func (a *AstReader) StmtLabel(n *ast.StmtLabel) {
+	a.flow.Label(nameString(n.Name), n.Position)
+}
+
+// StmtNamespace holds the statements of a namespace with braces. The
+// names declared are qualified through the declarations of the file.
+func (a *AstReader) StmtNamespace(n *ast.StmtNamespace) {
+	a.visitStmts(n.Stmts)
+}
+func (a *AstReader) StmtNop(n *ast.StmtNop) {
+	// the parser leaves an empty statement where it skipped code
+	a.unparseable(n.Position)
+}
+func (a *AstReader) StmtProperty(n *ast.StmtProperty)         {}
+func (a *AstReader) StmtPropertyList(n *ast.StmtPropertyList) {}
+
+// StmtReturn ends the path, but in the body of a function expanded where
+// it is called, where it goes on after the call.
+func (a *AstReader) StmtReturn(n *ast.StmtReturn) {
+	if a.flow.InCall() {
+		a.statement(n)
+		a.flow.Return()
+		return
+	}
+	a.terminal(n, NodeReturn, "")
+}
+func (a *AstReader) StmtStatic(n *ast.StmtStatic) {
+	a.statement(n)
+}
+func (a *AstReader) StmtStaticVar(n *ast.StmtStaticVar) {
+}
+func (a *AstReader) StmtStmtList(n *ast.StmtStmtList) {
+	a.visitStmts(n.Stmts)
+}
+
+// StmtSwitch tests the cases one after the other. A case body without
+// break falls through into the next one, which gets its own kind of edge
+// as it is a common source of bugs.
+func (a *AstReader) StmtSwitch(n *ast.StmtSwitch) {
+	a.expandCalls(n.Cond)
+	a.flow.BeginSwitch(a.flow.text(n.Cond))
+	a.visitStmts(n.Cases)
+	a.flow.EndSwitch()
+}
+func (a *AstReader) StmtThrow(n *ast.StmtThrow) {
+	a.statement(n)
+	a.flow.Throw(thrownClass(n.Expr))
+}
+func (a *AstReader) StmtTrait(n *ast.StmtTrait) {
+	a.visitStmts(n.Stmts)
+}
+func (a *AstReader) StmtTraitUse(n *ast.StmtTraitUse)                     {}
+func (a *AstReader) StmtTraitUseAlias(n *ast.StmtTraitUseAlias)           {}
+func (a *AstReader) StmtTraitUsePrecedence(n *ast.StmtTraitUsePrecedence) {}
+
+// StmtTry routes the exceptions thrown in its body to the catch clauses
+// by class. The finally block is spliced onto both the normal and the
+// exceptional exits.
+func (a *AstReader) StmtTry(n *ast.StmtTry) {
+	catches := make([][]string, 0, len(n.Catches))
+	for _, c := range n.Catches {
+		types := make([]string, 0)
+		for _, t := range c.(*ast.StmtCatch).Types {
+			types = append(types, nameString(t))
+		}
+		catches = append(catches, types)
+	}
+
+	a.flow.BeginTry(catches, n.Finally != nil)
+	a.visitStmts(n.Stmts)
+	a.flow.EndTryBody()
+	a.visitStmts(n.Catches)
+	a.visitStmt(n.Finally)
+	a.flow.EndTry()
+}
+func (a *AstReader) StmtUnset(n *ast.StmtUnset) {
+	a.statement(n)
+}
+func (a *AstReader) StmtUse(n *ast.StmtUseList)           {}
+func (a *AstReader) StmtGroupUse(n *ast.StmtGroupUseList) {}
+func (a *AstReader) StmtUseDeclaration(n *ast.StmtUse)    {}
+
+// StmtWhile checks the condition before every iteration.
+func (a *AstReader) StmtWhile(n *ast.StmtWhile) {
+	a.flow.BeginLoop()
+	entry := a.conditionCalls(n.Cond)
+	header := a.flow.LoopHeader(a.flow.text(n.Cond), n.Cond.GetPosition())
+	if entry == nil {
+		entry = header
+	}
+	a.flow.Follow(header, "true")
+	a.visitStmt(n.Stmt)
+	a.flow.JoinContinues()
+	a.flow.Repeat(entry)
+
+	a.flow.Follow(header, "false")
+	a.flow.EndLoop()
+}
+
+// conditionCalls expands the calls of the conditions of a loop, evaluated
+// before every iteration, and returns the node the expansion starts at,
+// where the iterations go back to. It returns nil when no call was
+// expanded.
+func (a *AstReader) conditionCalls(conds ...ast.Vertex) *Node {
+	g := a.flow.graph
+	first := len(g.Nodes)
+	for _, cond := range conds {
+		a.expandCalls(cond)
+	}
+	if len(g.Nodes) == first {
+		return nil
+	}
+	return g.Nodes[first]
+}
+
+// loopLevel reads the number of enclosing loops a break or continue
+// applies to, 1 when it has none.
+func loopLevel(expr ast.Vertex) int {
+	if lnum, ok := expr.(*ast.ScalarLnumber); ok {
+		if level, err := strconv.Atoi(string(lnum.Value)); err == nil && level > 0 {
+			return level
+		}
+	}
+	return 1
+}
+
+func (a *AstReader) ExprArray(n *ast.ExprArray)                 {}
+func (a *AstReader) ExprArrayDimFetch(n *ast.ExprArrayDimFetch) {}
+func (a *AstReader) ExprArrayItem(n *ast.ExprArrayItem)         {}
+
+// ExprArrowFunction draws an arrow function as a graph returning its
+// expression, named like a closure.
+func (a *AstReader) ExprArrowFunction(n *ast.ExprArrowFunction) {
+	if a.flow.InCall() || !a.inliner.declare(n.Position) {
+		return
+	}
+	saved := a.flow.BeginGraph(a.decls.closureName(n), n.Position)
+	a.flow.Signature(newParams(a.flow.src, n.Params), typeText(a.flow.src, n.ReturnType))
+	a.terminal(n.Expr, NodeReturn, "return "+a.flow.text(n.Expr))
+	a.nested([]ast.Vertex{n.Expr})
+	a.flow.EndGraph(saved)
+}
+func (a *AstReader) ExprBrackets(n *ast.ExprBrackets)               {}
+func (a *AstReader) ExprBitwiseNot(n *ast.ExprBitwiseNot)           {}
+func (a *AstReader) ExprBooleanNot(n *ast.ExprBooleanNot)           {}
+func (a *AstReader) ExprClassConstFetch(n *ast.ExprClassConstFetch) {}
+func (a *AstReader) ExprClone(n *ast.ExprClone)                     {}
+
+// ExprClosure draws the body of a closure as a graph of its own, named
+// {closure} followed by the file and line it is written at.
+func (a *AstReader) ExprClosure(n *ast.ExprClosure) {
+	if a.flow.InCall() || !a.inliner.declare(n.Position) {
+		return
+	}
+	saved := a.flow.BeginGraph(a.decls.closureName(n), n.Position)
+	a.flow.Signature(newParams(a.flow.src, n.Params), typeText(a.flow.src, n.ReturnType))
+	a.visitStmts(n.Stmts)
+	a.unparseable(n.Position)
+	a.nested(n.Stmts)
+	a.flow.EndGraph(saved)
+}
+func (a *AstReader) ExprClosureUse(n *ast.ExprClosureUse)       {}
+func (a *AstReader) ExprConstFetch(n *ast.ExprConstFetch)       {}
+func (a *AstReader) ExprEmpty(n *ast.ExprEmpty)                 {}
+func (a *AstReader) ExprErrorSuppress(n *ast.ExprErrorSuppress) {}
+func (a *AstReader) ExprEval(n *ast.ExprEval)                   {}
+func (a *AstReader) ExprExit(n *ast.ExprExit) {
+	a.terminal(n, NodeExit, "")
+}
+func (a *AstReader) ExprFunctionCall(n *ast.ExprFunctionCall) {}
+func (a *AstReader) ExprInclude(n *ast.ExprInclude) {
+	a.include(n.Expr, false)
+}
+func (a *AstReader) ExprIncludeOnce(n *ast.ExprIncludeOnce) {
+	a.include(n.Expr, true)
+}
+func (a *AstReader) ExprInstanceOf(n *ast.ExprInstanceOf)                 {}
+func (a *AstReader) ExprIsset(n *ast.ExprIsset)                           {}
+func (a *AstReader) ExprList(n *ast.ExprList)                             {}
+func (a *AstReader) ExprMethodCall(n *ast.ExprMethodCall)                 {}
+func (a *AstReader) ExprNullsafeMethodCall(n *ast.ExprNullsafeMethodCall) {}
+
+// ExprMatch is a decision with an edge per arm. Without a default arm a
+// value no arm matches throws an UnhandledMatchError.
+func (a *AstReader) ExprMatch(n *ast.ExprMatch) {
+	decision := a.flow.Decision(n.Expr)
+	decision.Label = "match (" + decision.Label + ")"
+
+	saved := a.flow.BeginChain()
+	hasDefault := false
+	for _, arm := range n.Arms {
+		arm := arm.(*ast.MatchArm)
+		label := "default"
+		if arm.DefaultTkn != nil {
+			hasDefault = true
+		} else {
+			conds := make([]string, 0, len(arm.Exprs))
+			for _, expr := range arm.Exprs {
+				conds = append(conds, a.flow.text(expr))
+			}
+			label = strings.Join(conds, ", ")
+		}
+
+		a.flow.Follow(decision, label)
+		arm.Accept(a.newChild())
+		a.flow.EndBranch()
+	}
+	if !hasDefault {
+		a.flow.Follow(decision, "no match")
+		a.flow.Throw("UnhandledMatchError")
+	}
+	a.flow.EndChain(saved)
+}
+func (a *AstReader) ExprNew(n *ast.ExprNew)                                     {}
+func (a *AstReader) ExprPostDec(n *ast.ExprPostDec)                             {}
+func (a *AstReader) ExprPostInc(n *ast.ExprPostInc)                             {}
+func (a *AstReader) ExprPreDec(n *ast.ExprPreDec)                               {}
+func (a *AstReader) ExprPreInc(n *ast.ExprPreInc)                               {}
+func (a *AstReader) ExprPrint(n *ast.ExprPrint)                                 {}
+func (a *AstReader) ExprPropertyFetch(n *ast.ExprPropertyFetch)                 {}
+func (a *AstReader) ExprNullsafePropertyFetch(n *ast.ExprNullsafePropertyFetch) {}
+func (a *AstReader) ExprRequire(n *ast.ExprRequire) {
+	a.include(n.Expr, false)
+}
+func (a *AstReader) ExprRequireOnce(n *ast.ExprRequireOnce) {
+	a.include(n.Expr, true)
+}
+func (a *AstReader) ExprShellExec(n *ast.ExprShellExec)                     {}
+func (a *AstReader) ExprStaticCall(n *ast.ExprStaticCall)                   {}
+func (a *AstReader) ExprStaticPropertyFetch(n *ast.ExprStaticPropertyFetch) {}
+func (a *AstReader) ExprTernary(n *ast.ExprTernary)                         {}
+
+// ExprThrow ends the path of a statement that is a throw expression.
+func (a *AstReader) ExprThrow(n *ast.ExprThrow) {
+	a.flow.Throw(thrownClass(n.Expr))
+}
+func (a *AstReader) ExprUnaryMinus(n *ast.ExprUnaryMinus) {}
+func (a *AstReader) ExprUnaryPlus(n *ast.ExprUnaryPlus)   {}
+func (a *AstReader) ExprVariable(n *ast.ExprVariable) {
+	n.Name.Accept(a)
+}
+func (a *AstReader) ExprYield(n *ast.ExprYield)         {}
+func (a *AstReader) ExprYieldFrom(n *ast.ExprYieldFrom) {}
+
+func (a *AstReader) ExprAssign(n *ast.ExprAssign)                     {}
+func (a *AstReader) ExprAssignReference(n *ast.ExprAssignReference)   {}
+func (a *AstReader) ExprAssignBitwiseAnd(n *ast.ExprAssignBitwiseAnd) {}
+func (a *AstReader) ExprAssignBitwiseOr(n *ast.ExprAssignBitwiseOr)   {}
+func (a *AstReader) ExprAssignBitwiseXor(n *ast.ExprAssignBitwiseXor) {}
+func (a *AstReader) ExprAssignCoalesce(n *ast.ExprAssignCoalesce)     {}
+func (a *AstReader) ExprAssignConcat(n *ast.ExprAssignConcat)         {}
+func (a *AstReader) ExprAssignDiv(n *ast.ExprAssignDiv)               {}
+func (a *AstReader) ExprAssignMinus(n *ast.ExprAssignMinus)           {}
+func (a *AstReader) ExprAssignMod(n *ast.ExprAssignMod)               {}
+func (a *AstReader) ExprAssignMul(n *ast.ExprAssignMul)               {}
+func (a *AstReader) ExprAssignPlus(n *ast.ExprAssignPlus)             {}
+func (a *AstReader) ExprAssignPow(n *ast.ExprAssignPow)               {}
+func (a *AstReader) ExprAssignShiftLeft(n *ast.ExprAssignShiftLeft)   {}
+func (a *AstReader) ExprAssignShiftRight(n *ast.ExprAssignShiftRight) {}
+
+func (a *AstReader) ExprBinaryBitwiseAnd(n *ast.ExprBinaryBitwiseAnd)         {}
+func (a *AstReader) ExprBinaryBitwiseOr(n *ast.ExprBinaryBitwiseOr)           {}
+func (a *AstReader) ExprBinaryBitwiseXor(n *ast.ExprBinaryBitwiseXor)         {}
+func (a *AstReader) ExprBinaryBooleanAnd(n *ast.ExprBinaryBooleanAnd)         {}
+func (a *AstReader) ExprBinaryBooleanOr(n *ast.ExprBinaryBooleanOr)           {}
+func (a *AstReader) ExprBinaryCoalesce(n *ast.ExprBinaryCoalesce)             {}
+func (a *AstReader) ExprBinaryConcat(n *ast.ExprBinaryConcat)                 {}
+func (a *AstReader) ExprBinaryDiv(n *ast.ExprBinaryDiv)                       {}
+func (a *AstReader) ExprBinaryEqual(n *ast.ExprBinaryEqual)                   {}
+func (a *AstReader) ExprBinaryGreater(n *ast.ExprBinaryGreater)               {}
+func (a *AstReader) ExprBinaryGreaterOrEqual(n *ast.ExprBinaryGreaterOrEqual) {}
+func (a *AstReader) ExprBinaryIdentical(n *ast.ExprBinaryIdentical)           {}
+func (a *AstReader) ExprBinaryLogicalAnd(n *ast.ExprBinaryLogicalAnd)         {}
+func (a *AstReader) ExprBinaryLogicalOr(n *ast.ExprBinaryLogicalOr)           {}
+func (a *AstReader) ExprBinaryLogicalXor(n *ast.ExprBinaryLogicalXor)         {}
+func (a *AstReader) ExprBinaryMinus(n *ast.ExprBinaryMinus)                   {}
+func (a *AstReader) ExprBinaryMod(n *ast.ExprBinaryMod)                       {}
+func (a *AstReader) ExprBinaryMul(n *ast.ExprBinaryMul)                       {}
+func (a *AstReader) ExprBinaryNotEqual(n *ast.ExprBinaryNotEqual)             {}
+func (a *AstReader) ExprBinaryNotIdentical(n *ast.ExprBinaryNotIdentical)     {}
+func (a *AstReader) ExprBinaryPlus(n *ast.ExprBinaryPlus)                     {}
+func (a *AstReader) ExprBinaryPow(n *ast.ExprBinaryPow)                       {}
+func (a *AstReader) ExprBinaryShiftLeft(n *ast.ExprBinaryShiftLeft)           {}
+func (a *AstReader) ExprBinaryShiftRight(n *ast.ExprBinaryShiftRight)         {}
+func (a *AstReader) ExprBinarySmaller(n *ast.ExprBinarySmaller)               {}
+func (a *AstReader) ExprBinarySmallerOrEqual(n *ast.ExprBinarySmallerOrEqual) {}
+func (a *AstReader) ExprBinarySpaceship(n *ast.ExprBinarySpaceship)           {}
+
+func (a *AstReader) ExprCastArray(n *ast.ExprCastArray)   {}
+func (a *AstReader) ExprCastBool(n *ast.ExprCastBool)     {}
+func (a *AstReader) ExprCastDouble(n *ast.ExprCastDouble) {}
+func (a *AstReader) ExprCastInt(n *ast.ExprCastInt)       {}
+func (a *AstReader) ExprCastObject(n *ast.ExprCastObject) {}
+func (a *AstReader) ExprCastString(n *ast.ExprCastString) {}
+func (a *AstReader) ExprCastUnset(n *ast.ExprCastUnset)   {}
+
+func (a *AstReader) ScalarDnumber(n *ast.ScalarDnumber)                               {}
+func (a *AstReader) ScalarEncapsed(n *ast.ScalarEncapsed)                             {}
+func (a *AstReader) ScalarEncapsedStringPart(n *ast.ScalarEncapsedStringPart)         {}
+func (a *AstReader) ScalarEncapsedStringVar(n *ast.ScalarEncapsedStringVar)           {}
+func (a *AstReader) ScalarEncapsedStringBrackets(n *ast.ScalarEncapsedStringBrackets) {}
+func (a *AstReader) ScalarHeredoc(n *ast.ScalarHeredoc)                               {}
+func (a *AstReader) ScalarLnumber(n *ast.ScalarLnumber)                               {}
+func (a *AstReader) ScalarMagicConstant(n *ast.ScalarMagicConstant)                   {}
+func (a *AstReader) ScalarString(n *ast.ScalarString)                                 {}
+
+func (a *AstReader) NameName(n *ast.Name)                         {}
+func (a *AstReader) NameFullyQualified(n *ast.NameFullyQualified) {}
+func (a *AstReader) NameRelative(n *ast.NameRelative)             {}
+func (a *AstReader) NameNamePart(n *ast.NamePart)                 {}
@@ -0,0 +1,162 @@
+package visualizephp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Diagram is what a Renderer draws: a *Flow, *IncludeGraph, *CallGraph
+// or *ClassDiagram.
+type Diagram interface {
+	diagram()
+}
+
+func (*Flow) diagram()         {}
+func (*IncludeGraph) diagram() {}
+func (*CallGraph) diagram()    {}
+func (*ClassDiagram) diagram() {}
+
+// Renderer draws diagrams in an output format. Renderers return an error
+// wrapping ErrUnsupported for the diagrams their format cannot show.
+type Renderer interface {
+	Render(w io.Writer, d Diagram) error
+}
+
+// ErrUnsupported is wrapped by the errors of renderers given a diagram
+// their format cannot show.
+var ErrUnsupported = errors.New("diagram not supported")
+
+func unsupported(format string, d Diagram) error {
+	return fmt.Errorf("%w: %s cannot draw %s", ErrUnsupported, format, diagramName(d))
+}
+
+func diagramName(d Diagram) string {
+	switch d.(type) {
+	case *Flow:
+		return "flowcharts"
+	case *IncludeGraph:
+		return "include graphs"
+	case *CallGraph:
+		return "call graphs"
+	case *ClassDiagram:
+		return "class diagrams"
+	}
+	return fmt.Sprintf("%T", d)
+}
+
+// renderersMu guards renderers, which RegisterRenderer may change while
+// others look renderers up.
+var renderersMu sync.RWMutex
+
+var renderers = map[string]Renderer{
+	"dot":      DotRenderer{},
+	"mermaid":  MermaidRenderer{},
+	"plantuml": PlantUMLRenderer{},
+	"svg":      SVGRenderer{},
+	"html":     HTMLRenderer{},
+	"json":     JSONRenderer{},
+}
+
+// RegisterRenderer makes r the renderer of format, replacing the one it
+// had.
+func RegisterRenderer(format string, r Renderer) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	renderers[format] = r
+}
+
+// LookupRenderer returns the renderer of format, nil if there is none.
+func LookupRenderer(format string) Renderer {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+	return renderers[format]
+}
+
+// RendererFormats returns the formats renderers are registered for,
+// sorted.
+func RendererFormats() []string {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+	formats := make([]string, 0, len(renderers))
+	for format := range renderers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// DotRenderer writes Graphviz DOT, for every diagram.
+type DotRenderer struct{}
+
+func (DotRenderer) Render(w io.Writer, d Diagram) error {
+	switch d := d.(type) {
+	case *Flow:
+		return WriteDot(w, d)
+	case *IncludeGraph:
+		return WriteIncludeDot(w, d)
+	case *CallGraph:
+		return WriteCallsDot(w, d)
+	case *ClassDiagram:
+		return WriteClassesDot(w, d)
+	}
+	return unsupported("dot", d)
+}
+
+// MermaidRenderer writes Mermaid, for every diagram.
+type MermaidRenderer struct{}
+
+func (MermaidRenderer) Render(w io.Writer, d Diagram) error {
+	switch d := d.(type) {
+	case *Flow:
+		return WriteMermaid(w, d)
+	case *IncludeGraph:
+		return WriteIncludeMermaid(w, d)
+	case *CallGraph:
+		return WriteCallsMermaid(w, d)
+	case *ClassDiagram:
+		return WriteClassesMermaid(w, d)
+	}
+	return unsupported("mermaid", d)
+}
+
+// PlantUMLRenderer writes PlantUML activity diagrams of flows and class
+// diagrams.
+type PlantUMLRenderer struct{}
+
+func (PlantUMLRenderer) Render(w io.Writer, d Diagram) error {
+	switch d := d.(type) {
+	case *Flow:
+		return WritePlantUML(w, d)
+	case *ClassDiagram:
+		return WriteClassesPlantUML(w, d)
+	}
+	return unsupported("plantuml", d)
+}
+
+// SVGRenderer lays out flows and writes them as SVG images.
+type SVGRenderer struct{}
+
+func (SVGRenderer) Render(w io.Writer, d Diagram) error {
+	if flow, ok := d.(*Flow); ok {
+		return WriteSVG(w, flow)
+	}
+	return unsupported("svg", d)
+}
+
+// HTMLRenderer writes flows as HTML pages, see WriteHTML. The source of
+// the nodes is shown for the flows built by BuildFlow.
+type HTMLRenderer struct{}
+
+func (HTMLRenderer) Render(w io.Writer, d Diagram) error {
+	flow, ok := d.(*Flow)
+	if !ok {
+		return unsupported("html", d)
+	}
+	if flow.source == nil {
+		return WriteHTML(w, flow, nil, "")
+	}
+	return WriteHTML(w, flow, flow.source.src, flow.source.file)
+}
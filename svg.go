@@ -0,0 +1,244 @@
+package visualizephp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// clusterPad is the space between a graph and the box around it, title
+// excluded.
+const clusterPad = 15.0
+
+// WriteSVG lays out the flow and writes it as an SVG image, a box per
+// graph stacked from top to bottom. It needs no external tool and writes
+// the same image for the same flow. Nodes and graphs carry the ids used
+// by WriteDot.
+func WriteSVG(w io.Writer, flow *Flow) error {
+	layouts := make([]*graphLayout, 0, len(flow.Graphs))
+	width := 0.0
+	for _, g := range flow.Graphs {
+		l := layoutGraph(g)
+		layouts = append(layouts, l)
+		if cw := l.width + 2*clusterPad + 20; cw > width {
+			width = cw
+		}
+	}
+	height := 0.0
+	for _, l := range layouts {
+		height += l.height + 2*clusterPad + lineHeight + nodePad
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %s %s" font-family="monospace" font-size="%s">`+"\n",
+		num(width), num(height), num(width), num(height), num(fontSize))
+	fmt.Fprintln(out, "<defs>")
+	for _, c := range []string{"black", "red", "orange"} {
+		fmt.Fprintf(out, `<marker id="arrow-%s" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto"><path d="M0,0 L10,5 L0,10 z" fill="%s"/></marker>`+"\n", c, c)
+	}
+	fmt.Fprintln(out, "</defs>")
+
+	y := 0.0
+	for i, l := range layouts {
+		clusterHeight := l.height + 2*clusterPad + lineHeight + nodePad
+		fmt.Fprintf(out, `<g id="g%d" class="cluster">`+"\n", i)
+		fmt.Fprintf(out, `<rect x="0" y="%s" width="%s" height="%s" fill="none" stroke="#999"/>`+"\n",
+			num(y), num(width), num(clusterHeight))
+		fmt.Fprintf(out, `<text x="%s" y="%s" text-anchor="middle" font-weight="bold">%s</text>`+"\n",
+			num(width/2), num(y+lineHeight), svgEscape(l.graph.Name))
+
+		dx := (width - l.width) / 2
+		dy := y + lineHeight + nodePad + clusterPad
+		writeSVGInclusions(out, i, l, dx, dy)
+		for _, e := range l.edges {
+			writeSVGEdge(out, e, dx, dy)
+		}
+		for _, n := range l.nodes {
+			if n.node != nil {
+				writeSVGNode(out, i, n, dx, dy)
+			}
+		}
+		fmt.Fprintln(out, "</g>")
+		y += clusterHeight
+	}
+	fmt.Fprintln(out, "</svg>")
+	return out.Flush()
+}
+
+// writeSVGInclusions draws a dashed box around the nodes of each inlined
+// file. The layout does not keep them together, so a box may hold other
+// nodes too.
+func writeSVGInclusions(out *bufio.Writer, graph int, l *graphLayout, dx, dy float64) {
+	g := l.graph
+	for _, inc := range g.Inclusions {
+		// files inlined in this one get boxes of their own, inside
+		nested := 0
+		var left, top, right, bottom float64
+		found := false
+		for _, ln := range l.nodes {
+			if ln.node == nil {
+				continue
+			}
+			depth := -1
+			for c, d := g.cluster(ln.node), 0; c != nil; c, d = g.own(c.Parent), d+1 {
+				if c == inc {
+					depth = d
+				}
+			}
+			if depth < 0 {
+				continue
+			}
+			if depth > nested {
+				nested = depth
+			}
+			l, t, r, b := ln.x-ln.w/2, ln.y-ln.h/2, ln.x+ln.w/2, ln.y+ln.h/2
+			if !found {
+				left, top, right, bottom, found = l, t, r, b, true
+			}
+			left, top = math.Min(left, l), math.Min(top, t)
+			right, bottom = math.Max(right, r), math.Max(bottom, b)
+		}
+		if !found {
+			continue
+		}
+		pad := nodePad * float64(nested+1)
+		left, top, right, bottom = left+dx-pad, top+dy-pad, right+dx+pad, bottom+dy+pad
+		fmt.Fprintf(out, `<g id="%s" class="inclusion"><rect x="%s" y="%s" width="%s" height="%s" fill="none" stroke="#666" stroke-dasharray="5,3"/>`,
+			inclusionKey(graph, inc), num(left), num(top), num(right-left), num(bottom-top))
+		fmt.Fprintf(out, `<text x="%s" y="%s" fill="#666">%s</text></g>`+"\n", num(left+2), num(top-3), svgEscape(inc.Name()))
+	}
+}
+
+func writeSVGNode(out *bufio.Writer, graph int, ln *layoutNode, dx, dy float64) {
+	n := ln.node
+	x, y := ln.x+dx, ln.y+dy
+	w, h := ln.w, ln.h
+	left, top := x-w/2, y-h/2
+
+	fmt.Fprintf(out, `<g id="%s" class="node">`, nodeKey(graph, n))
+	title := n.Kind.String()
+	if n.Loc != nil {
+		title += " " + n.Loc.String()
+	}
+	fmt.Fprintf(out, "<title>%s</title>", svgEscape(title))
+	const style = `fill="white" stroke="black"`
+	switch n.Kind {
+	case NodeStart, NodeEnd:
+		fmt.Fprintf(out, `<ellipse cx="%s" cy="%s" rx="%s" ry="%s" %s/>`, num(x), num(y), num(w/2), num(h/2), style)
+	case NodeReturn:
+		fmt.Fprintf(out, `<ellipse cx="%s" cy="%s" rx="%s" ry="%s" %s/>`, num(x), num(y), num(w/2+4), num(h/2+4), style)
+		fmt.Fprintf(out, `<ellipse cx="%s" cy="%s" rx="%s" ry="%s" %s/>`, num(x), num(y), num(w/2), num(h/2), style)
+	case NodeThrow:
+		fmt.Fprintf(out, `<ellipse cx="%s" cy="%s" rx="%s" ry="%s" fill="white" stroke="red"/>`, num(x), num(y), num(w/2), num(h/2))
+	case NodeDecision, NodeLoop:
+		svgPolygon(out, style, point{x, top}, point{left + w, y}, point{x, top + h}, point{left, y})
+	case NodeExit:
+		c := h / 3
+		svgPolygon(out, style,
+			point{left + c, top}, point{left + w - c, top}, point{left + w, top + c}, point{left + w, top + h - c},
+			point{left + w - c, top + h}, point{left + c, top + h}, point{left, top + h - c}, point{left, top + c})
+	case NodeMerge:
+		if n.Label == "" {
+			fmt.Fprintf(out, `<circle cx="%s" cy="%s" r="%s" fill="black"/>`, num(x), num(y), num(w/2))
+		} else {
+			fmt.Fprintf(out, `<rect x="%s" y="%s" width="%s" height="%s" rx="6" %s/>`, num(left), num(top), num(w), num(h), style)
+		}
+	case NodeCatch:
+		fmt.Fprintf(out, `<rect x="%s" y="%s" width="%s" height="%s" stroke-dasharray="5,3" %s/>`, num(left), num(top), num(w), num(h), style)
+	case NodeUnparseable:
+		fmt.Fprintf(out, `<rect x="%s" y="%s" width="%s" height="%s" fill="mistyrose" stroke="red"/>`, num(left), num(top), num(w), num(h))
+	case NodeRecursion:
+		fmt.Fprintf(out, `<rect x="%s" y="%s" width="%s" height="%s" rx="6" stroke-dasharray="5,3" %s/>`, num(left), num(top), num(w), num(h), style)
+	case NodeLabel:
+		svgPolygon(out, style, point{left, top}, point{left + w - h/2, top}, point{left + w, y}, point{left + w - h/2, top + h}, point{left, top + h})
+	default:
+		if n.Output() {
+			s := h / 2
+			svgPolygon(out, style, point{left + s, top}, point{left + w, top}, point{left + w - s, top + h}, point{left, top + h})
+		} else {
+			fmt.Fprintf(out, `<rect x="%s" y="%s" width="%s" height="%s" %s/>`, num(left), num(top), num(w), num(h), style)
+		}
+	}
+
+	lines := nodeLines(n)
+	if n.Kind == NodeMerge && n.Label == "" {
+		lines = nil
+	}
+	textY := y - float64(len(lines))*lineHeight/2 + lineHeight*0.75
+	for i, line := range lines {
+		if n.Kind == NodeBlock {
+			textX := left + nodePad
+			if n.Output() {
+				textX += h / 2
+			}
+			fmt.Fprintf(out, `<text x="%s" y="%s" xml:space="preserve">%s</text>`, num(textX), num(textY+float64(i)*lineHeight), svgEscape(line))
+		} else {
+			fmt.Fprintf(out, `<text x="%s" y="%s" text-anchor="middle" xml:space="preserve">%s</text>`, num(x), num(textY+float64(i)*lineHeight), svgEscape(line))
+		}
+	}
+	fmt.Fprintln(out, "</g>")
+}
+
+func writeSVGEdge(out *bufio.Writer, le *layoutEdge, dx, dy float64) {
+	color := "black"
+	dash := ""
+	width := "1"
+	switch le.edge.Kind {
+	case EdgeBack:
+		dash = ` stroke-dasharray="6,3"`
+	case EdgeFallthrough:
+		color, width = "orange", "2.5"
+	case EdgeException:
+		color, dash = "red", ` stroke-dasharray="6,3"`
+	case EdgeGoto:
+		dash = ` stroke-dasharray="2,3"`
+	}
+
+	var d strings.Builder
+	for i, p := range le.points {
+		if i == 0 {
+			d.WriteString("M")
+		} else {
+			d.WriteString(" L")
+		}
+		d.WriteString(num(p.x+dx) + "," + num(p.y+dy))
+	}
+	fmt.Fprint(out, `<g class="edge">`)
+	if le.edge.Loc != nil {
+		fmt.Fprintf(out, "<title>%s</title>", svgEscape(le.edge.Loc.String()))
+	}
+	fmt.Fprintf(out, `<path d="%s" fill="none" stroke="%s" stroke-width="%s"%s marker-end="url(#arrow-%s)"/>`,
+		d.String(), color, width, dash, color)
+	if le.edge.Label != "" && len(le.points) > 1 {
+		a, b := le.points[0], le.points[1]
+		fmt.Fprintf(out, `<text x="%s" y="%s" fill="%s">%s</text>`,
+			num((a.x+b.x)/2+dx+4), num((a.y+b.y)/2+dy), color, svgEscape(le.edge.Label))
+	}
+	fmt.Fprintln(out, "</g>")
+}
+
+func svgPolygon(out *bufio.Writer, style string, points ...point) {
+	coords := make([]string, 0, len(points))
+	for _, p := range points {
+		coords = append(coords, num(p.x)+","+num(p.y))
+	}
+	fmt.Fprintf(out, `<polygon points="%s" %s/>`, strings.Join(coords, " "), style)
+}
+
+// num formats a coordinate with a single decimal, keeping the output
+// short and stable.
+func num(f float64) string {
+	return strconv.FormatFloat(f, 'f', 1, 64)
+}
+
+func svgEscape(s string) string {
+	return strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		">", "&gt;",
+		`"`, "&quot;",
+	).Replace(s)
+}
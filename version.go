@@ -0,0 +1,146 @@
+package visualizephp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/VKCOM/php-parser/pkg/version"
+)
+
+// DefaultPHPVersion is the version used when nothing says otherwise.
+const DefaultPHPVersion = "7.4"
+
+// newestGrammar is the newest minor version the parser knows, by major
+// version.
+var newestGrammar = map[uint64]uint64{5: 6, 7: 4, 8: 1}
+
+// versionComment is the per-file override, a comment such as
+// "// visualize-php: 8.1" anywhere in the file.
+var versionComment = regexp.MustCompile(`(?m)^\s*(?://|#|/?\*+)\s*visualize-php:\s*([0-9]+(?:\.[0-9]+)?)`)
+
+// PHPVersion picks the PHP version to parse a file with. In order of
+// precedence it is the version given in a visualize-php comment of the
+// file, the given version, or the one found in the nearest composer.json
+// above the file, either config.platform.php or the lowest version
+// allowed by require.php. It is DefaultPHPVersion otherwise.
+func PHPVersion(file string, src []byte, given string) (string, error) {
+	if m := versionComment.FindSubmatch(src); m != nil {
+		return string(m[1]), nil
+	}
+	if given != "" {
+		return given, nil
+	}
+	composer, err := findComposer(filepath.Dir(file))
+	if err != nil || composer == "" {
+		return DefaultPHPVersion, err
+	}
+	v, err := composerPHPVersion(composer)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", composer, err)
+	}
+	if v == "" {
+		return DefaultPHPVersion, nil
+	}
+	return v, nil
+}
+
+// findComposer returns the composer.json in dir or the closest of its
+// parents, or "" if there is none.
+func findComposer(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, "composer.json")
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+func composerPHPVersion(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var composer struct {
+		Require map[string]string
+		Config  struct {
+			Platform map[string]string
+		}
+	}
+	if err := json.Unmarshal(data, &composer); err != nil {
+		return "", err
+	}
+	if v := composer.Config.Platform["php"]; v != "" {
+		return lowestVersion(v), nil
+	}
+	return lowestVersion(composer.Require["php"]), nil
+}
+
+// lowestVersion returns the major.minor of the lowest version a Composer
+// constraint such as "^7.4 || ^8.0" or ">=7.2 <8.0" allows, "" if it has
+// no lower bound. Code meant to run on that version may not use newer
+// syntax.
+func lowestVersion(constraint string) string {
+	var lowest []uint64
+	for _, alt := range strings.Split(strings.ReplaceAll(constraint, "||", "|"), "|") {
+		for _, term := range strings.FieldsFunc(alt, func(r rune) bool { return r == ' ' || r == ',' }) {
+			if strings.HasPrefix(term, "<") || strings.HasPrefix(term, "!") {
+				continue
+			}
+			term = strings.TrimLeft(term, "^~>=v")
+			parts := strings.SplitN(term, ".", 3)
+			major, err := strconv.ParseUint(parts[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			var minor uint64
+			if len(parts) > 1 {
+				// "7.*" allows 7.0
+				minor, _ = strconv.ParseUint(parts[1], 10, 64)
+			}
+			if lowest == nil || major < lowest[0] || major == lowest[0] && minor < lowest[1] {
+				lowest = []uint64{major, minor}
+			}
+		}
+	}
+	if lowest == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d.%d", lowest[0], lowest[1])
+}
+
+// parserVersion parses a PHP version for the parser. Versions newer than
+// the parser knows, such as 8.2, get the newest grammar of their major
+// version.
+func parserVersion(v string) (*version.Version, error) {
+	// keep major.minor of "8" or "8.2.1"
+	parts := strings.SplitN(v, ".", 3)
+	if len(parts) == 1 {
+		parts = append(parts, "0")
+	}
+	pv, err := version.New(parts[0] + "." + parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("PHP version %q: %v", v, err)
+	}
+	if newest, ok := newestGrammar[pv.Major]; ok && pv.Minor > newest {
+		pv.Minor = newest
+	}
+	if err := pv.Validate(); err != nil {
+		return nil, fmt.Errorf("PHP version %q: %v", v, err)
+	}
+	return pv, nil
+}